@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// activityDays is how many days of reading activity are kept.
+const activityDays = 366
+
+// dateFormat is the format of the dates of Activity, in local time.
+const dateFormat = "2006-01-02"
+
+// Activity records the reading done each day, over all books, keyed by local
+// date.
+type Activity map[string]Day
+
+// Day is the reading done in a day.
+type Day struct {
+	Seconds  int64
+	Chapters int
+}
+
+// Active reports whether enough reading was done in the day for it to count
+// in a streak: at least a minute, or a chapter finished.
+func (d Day) Active() bool {
+	return d.Seconds >= 60 || d.Chapters > 0
+}
+
+func activityFname() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "activity.json"), nil
+}
+
+// LoadActivity reads the reading activity. A missing file isn't an error.
+func LoadActivity() (Activity, error) {
+	fname, err := activityFname()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		return Activity{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	activity := Activity{}
+	dec := json.NewDecoder(f)
+	err = dec.Decode(&activity)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+
+	return activity, nil
+}
+
+// SaveActivity writes the reading activity, forgetting the days older than
+// activityDays.
+func SaveActivity(activity Activity) error {
+	fname, err := activityFname()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return err
+	}
+
+	oldest := time.Now().AddDate(0, 0, -activityDays).Format(dateFormat)
+	for date := range activity {
+		if date < oldest {
+			delete(activity, date)
+		}
+	}
+
+	return writeJSON(fname, activity)
+}
+
+// Add records a reading session from start to end, during which reading
+// time was spent and chapters finished. A session going past midnight has
+// its time split between both days, its chapters counting for the last one.
+func (a Activity) Add(start, end time.Time, reading time.Duration, chapters int) {
+	start, end = start.Local(), end.Local()
+	for !start.IsZero() && end.After(start) {
+		y, m, d := start.Date()
+		midnight := time.Date(y, m, d+1, 0, 0, 0, 0, time.Local)
+		if !end.After(midnight) {
+			break
+		}
+
+		// the share of the reading time spent before midnight
+		share := time.Duration(float64(reading) * float64(midnight.Sub(start)) / float64(end.Sub(start)))
+		a.add(start, share, 0)
+		start, reading = midnight, reading-share
+	}
+	a.add(end, reading, chapters)
+}
+
+func (a Activity) add(t time.Time, reading time.Duration, chapters int) {
+	date := t.Format(dateFormat)
+	day := a[date]
+	day.Seconds += int64(reading / time.Second)
+	day.Chapters += chapters
+	a[date] = day
+}
+
+// Streak returns the number of consecutive active days up to now. Today not
+// being active yet doesn't break the streak, which then ends yesterday.
+func (a Activity) Streak(now time.Time) int {
+	day := now.Local()
+	if !a[day.Format(dateFormat)].Active() {
+		day = day.AddDate(0, 0, -1)
+	}
+
+	streak := 0
+	for a[day.Format(dateFormat)].Active() {
+		streak++
+		day = day.AddDate(0, 0, -1)
+	}
+
+	return streak
+}
+
+// finishedChapters returns the number of chapters whose end was reached.
+func (b Book) finishedChapters() int {
+	n := 0
+	for _, f := range b.Furthest {
+		if f >= 1 {
+			n++
+		}
+	}
+
+	return n
+}
+
+// recordActivity adds the current session to the reading activity.
+func (b *Book) recordActivity() error {
+	activity, err := LoadActivity()
+	if err != nil {
+		return err
+	}
+	activity.Add(b.sessionStart, time.Now(), b.SessionTime(), b.finishedChapters()-b.finishedBefore)
+
+	return SaveActivity(activity)
+}
+
+// streakText describes the reading streak, including the current session,
+// or returns an empty string if there is none.
+func (b Book) streakText() string {
+	activity, err := LoadActivity()
+	if err != nil {
+		return ""
+	}
+	activity.Add(b.sessionStart, time.Now(), b.SessionTime(), b.finishedChapters()-b.finishedBefore)
+
+	switch n := activity.Streak(time.Now()); n {
+	case 0:
+		return ""
+	case 1:
+		return "🔥 1-day streak"
+	default:
+		return fmt.Sprintf("🔥 %d-day streak", n)
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// autosave saves the state of the book every interval until stop is closed.
+// The state is read from the event loop, to avoid racing with the UI.
+func (b *Book) autosave(fname string, interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		}
+
+		b.app.QueueUpdate(func() {
+			// errors are reported by the final save, on exit
+			_ = SaveState(fname, b.State())
+		})
+	}
+}
+
+// quitWhenIdle stops the reader once no key was pressed for timeout, the
+// state being saved on the way out like on quitting, until stop is closed.
+// Each key press is sent on b.activity. The reader doesn't quit while text is
+// typed in an input, like a search.
+func (b *Book) quitWhenIdle(timeout time.Duration, stop <-chan struct{}) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-b.activity:
+			if !timer.Stop() {
+				<-timer.C
+			}
+		case <-timer.C:
+			b.app.QueueUpdate(func() {
+				switch b.overlay {
+				case "search", "command", "toc-filter", "note":
+					return
+				}
+				b.app.Stop()
+			})
+		}
+		timer.Reset(timeout)
+	}
+}
+
+// stopOnSignal stops the reader when the process is asked to terminate or
+// its terminal goes away, so that the state is saved on the way out. It
+// returns once stop is closed.
+func (b *Book) stopOnSignal(stop <-chan struct{}) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	defer signal.Stop(signals)
+
+	select {
+	case <-stop:
+	case <-signals:
+		b.app.Stop()
+	}
+}
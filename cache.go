@@ -0,0 +1,127 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheVersion is bumped whenever the conversion changes, discarding the
+// caches filled by previous versions.
+const cacheVersion = 10
+
+// Cache holds the text converted from each chapter's HTML, so that it doesn't
+// need to be converted again when the book is reopened.
+type Cache struct {
+	Version int
+
+	// ModTime is the modification time of the book when the cache was
+	// filled, the cache is discarded when it changes.
+	ModTime time.Time
+	// Decorations and Transforms identify the class decorations and the
+	// transforms the text was converted with, the cache is discarded when
+	// they change.
+	Decorations string
+	Transforms  string
+	Chapters    map[string]CachedChapter
+
+	fname string
+	dirty bool
+}
+
+type CachedChapter struct {
+	// Hash is the hash of the chapter's HTML the text was converted from.
+	Hash string
+	Content
+}
+
+// cacheFname returns the cache file of the book, kept in the state directory
+// along with its state when one is set, next to the book otherwise.
+func cacheFname(bookFname string) string {
+	if dir := stateDir(); dir != "" {
+		return filepath.Join(dir, bookID(bookFname)+".cache.json")
+	}
+
+	return filepath.Join(
+		filepath.Dir(bookFname),
+		"."+filepath.Base(bookFname)+".lectern-cache.json",
+	)
+}
+
+func contentHash(buf []byte) string {
+	sum := sha256.Sum256(buf)
+
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadCache loads the cache for the given book. Since the cache can always be
+// rebuilt, a missing, unreadable or outdated cache yields an empty one.
+func LoadCache(bookFname string) *Cache {
+	cache := &Cache{
+		Version:     cacheVersion,
+		Decorations: decorationsKey(classDecorations),
+		Transforms:  transformsKey(textTransforms),
+		Chapters:    map[string]CachedChapter{},
+		fname:       cacheFname(bookFname),
+	}
+
+	info, err := os.Stat(bookFname)
+	if err != nil {
+		return cache
+	}
+	cache.ModTime = info.ModTime()
+
+	f, err := os.Open(cache.fname)
+	if err != nil {
+		return cache
+	}
+	defer f.Close()
+
+	var loaded Cache
+	dec := json.NewDecoder(f)
+	err = dec.Decode(&loaded)
+	if err != nil || loaded.Version != cacheVersion || loaded.Decorations != cache.Decorations || loaded.Transforms != cache.Transforms || !loaded.ModTime.Equal(cache.ModTime) || loaded.Chapters == nil {
+		return cache
+	}
+	cache.Chapters = loaded.Chapters
+
+	return cache
+}
+
+func (c *Cache) Get(u, hash string) (Content, bool) {
+	cached, ok := c.Chapters[u]
+	if !ok || cached.Hash != hash {
+		return Content{}, false
+	}
+
+	return cached.Content, true
+}
+
+func (c *Cache) Set(u, hash string, content Content) {
+	c.Chapters[u] = CachedChapter{
+		Hash:    hash,
+		Content: content,
+	}
+	c.dirty = true
+}
+
+func (c *Cache) Save() error {
+	if !c.dirty {
+		return nil
+	}
+
+	err := os.MkdirAll(filepath.Dir(c.fname), 0755)
+	if err != nil {
+		return err
+	}
+	err = writeJSON(c.fname, c)
+	if err != nil {
+		return err
+	}
+	c.dirty = false
+
+	return nil
+}
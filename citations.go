@@ -0,0 +1,164 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// The citation styles, CitationPlain being the default one.
+const (
+	CitationPlain    = "plain"
+	CitationMarkdown = "markdown"
+)
+
+// Citation is a quote from the book, along with what is needed to cite it.
+type Citation struct {
+	Text      string
+	Authors   []string
+	Title     string
+	Publisher string
+	Year      string
+
+	// Chapter is the number of the chapter, from 1, Position the percentage
+	// of the chapter the quote starts at.
+	Chapter      int
+	ChapterTitle string
+	Position     int
+	Date         time.Time
+}
+
+// Format formats the citation in the given style, CitationPlain or
+// CitationMarkdown.
+func (c Citation) Format(style string) string {
+	title := c.Title
+	if style == CitationMarkdown {
+		title = "*" + title + "*"
+	}
+	source := []string{title}
+	if len(c.Authors) > 0 {
+		source = append([]string{strings.Join(c.Authors, ", ")}, source...)
+	}
+	reference := strings.Join(source, ", ") + "."
+	var published []string
+	for _, s := range []string{c.Publisher, c.Year} {
+		if s != "" {
+			published = append(published, s)
+		}
+	}
+	if len(published) > 0 {
+		reference += " " + strings.Join(published, ", ") + "."
+	}
+	reference += fmt.Sprintf(" Chapter %d", c.Chapter)
+	if c.ChapterTitle != "" {
+		reference += fmt.Sprintf(", “%s”", c.ChapterTitle)
+	}
+	reference += fmt.Sprintf(", %d%%.", c.Position)
+	date := "Quoted on " + c.Date.Format(dateFormat) + "."
+
+	if style == CitationMarkdown {
+		quote := strings.Replace(c.Text, "\n", "\n> ", -1)
+		quote = strings.Replace(quote, "> \n", ">\n", -1)
+		return fmt.Sprintf("> %s\n>\n> — %s\n\n%s\n", quote, reference, date)
+	}
+
+	return fmt.Sprintf("“%s”\n— %s\n%s\n", c.Text, reference, date)
+}
+
+// citationsFname returns the file the citations from the book are appended
+// to, in the given style.
+func citationsFname(bookFname, style string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	ext := ".txt"
+	if style == CitationMarkdown {
+		ext = ".md"
+	}
+
+	return filepath.Join(dir, "citations", bookID(bookFname)+ext), nil
+}
+
+// Cite records the paragraph at the top of the current chapter, or on the
+// focus line when shown, as a citation.
+func (b *Book) Cite() {
+	if b.Current == b.TOC.Index() {
+		return
+	}
+	c := b.Chapters[b.Current]
+
+	r := c.GetOffset()
+	if b.FocusLine {
+		r += b.focusLineOffset(c.height)
+	}
+	b.cite(c.paragraphText(r))
+}
+
+// cite appends the text starting at the wrapped line of the current chapter
+// to the book's citations file, along with the book's metadata.
+func (b *Book) cite(line int, text string) {
+	if text == "" {
+		b.Flash("nothing to cite")
+		return
+	}
+	c := b.Chapters[b.Current]
+
+	citation := Citation{
+		Text:         text,
+		Title:        b.Title,
+		Chapter:      b.Current + 1,
+		ChapterTitle: c.title,
+		Date:         time.Now(),
+	}
+	citation.Authors, _ = b.ebook.Metadata("creator")
+	if publishers, err := b.ebook.Metadata("publisher"); err == nil && len(publishers) > 0 {
+		citation.Publisher = publishers[0]
+	}
+	if dates, err := b.ebook.Metadata("date"); err == nil && len(dates) > 0 && len(dates[0]) >= 4 {
+		citation.Year = dates[0][:4]
+	}
+	if n, err := c.t.NLines(); err == nil && n > 0 {
+		citation.Position = 100 * line / n
+	}
+
+	style := b.CitationStyle
+	if style != CitationMarkdown {
+		style = CitationPlain
+	}
+	fname, err := citationsFname(b.fname, style)
+	if err == nil {
+		err = appendCitation(fname, citation.Format(style))
+	}
+	if err != nil {
+		b.Flash(fmt.Sprintf("saving the citation: %s", err))
+		return
+	}
+	b.Flash("citation added to " + fname)
+}
+
+// appendCitation appends a formatted citation to the file, separated from
+// the previous one by a blank line.
+func appendCitation(fname, citation string) error {
+	err := os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if info, err := f.Stat(); err == nil && info.Size() > 0 {
+		citation = "\n" + citation
+	}
+	_, err = f.WriteString(citation)
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
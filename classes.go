@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// sceneBreak is written in place of horizontal rules and scene break
+// elements, centered when displayed.
+const sceneBreak = "* * *"
+
+// The decorations elements can be given from their CSS class:
+//   - scene-break replaces the element with a scene break,
+//   - drop-cap keeps the element in the line of the text it starts, an
+//     image being replaced with its alt text,
+//   - quote indents the element like a blockquote,
+//   - emphasis and strong format the element like em and strong,
+//   - hidden leaves the element out.
+var decorations = map[string]bool{
+	"scene-break": true, "drop-cap": true, "quote": true,
+	"emphasis": true, "strong": true, "hidden": true,
+}
+
+// DefaultClassDecorations maps common CSS class names to their decoration,
+// unless overridden in the config file.
+var DefaultClassDecorations = map[string]string{
+	"break":         "scene-break",
+	"scenebreak":    "scene-break",
+	"scene-break":   "scene-break",
+	"sectionbreak":  "scene-break",
+	"section-break": "scene-break",
+	"space-break":   "scene-break",
+	"transition":    "scene-break",
+	"dropcap":       "drop-cap",
+	"drop-cap":      "drop-cap",
+	"dropcaps":      "drop-cap",
+	"first-letter":  "drop-cap",
+	"epigraph":      "quote",
+}
+
+// classDecorations is the decoration of each CSS class used by the HTML
+// conversion, set from the config file.
+var classDecorations = DefaultClassDecorations
+
+// ClassDecorations merges the configured class decorations with
+// DefaultClassDecorations, an empty decoration removing the default one.
+// Unknown decorations are reported as warnings.
+func (cfg Config) ClassDecorations() (map[string]string, []string) {
+	var warnings []string
+
+	classes := map[string]string{}
+	for class, decoration := range DefaultClassDecorations {
+		classes[class] = decoration
+	}
+	for class, decoration := range cfg.Classes {
+		switch {
+		case decoration == "":
+			delete(classes, class)
+		case decorations[decoration]:
+			classes[class] = decoration
+		default:
+			warnings = append(warnings, fmt.Sprintf("unknown decoration %q for class %q", decoration, class))
+		}
+	}
+	sort.Strings(warnings)
+
+	return classes, warnings
+}
+
+// decorationsKey identifies the class decorations the text was converted
+// with, so that cached conversions are discarded when they change.
+func decorationsKey(classes map[string]string) string {
+	pairs := make([]string, 0, len(classes))
+	for class, decoration := range classes {
+		pairs = append(pairs, class+"="+decoration)
+	}
+	sort.Strings(pairs)
+
+	return strings.Join(pairs, ";")
+}
+
+// decoration returns the decoration of n given by its first decorated class,
+// scene-break for horizontal rules, or an empty string.
+func decoration(n *html.Node) string {
+	if n.Data == "hr" {
+		return "scene-break"
+	}
+	v, _ := attr(n, "class")
+	for _, class := range strings.Fields(v) {
+		if d, ok := classDecorations[strings.ToLower(class)]; ok {
+			return d
+		}
+	}
+
+	return ""
+}
+
+// writeSceneBreak writes a scene break as a paragraph of its own.
+func (c *converter) writeSceneBreak() {
+	c.blockBreak(2)
+	c.write(sceneBreak)
+	c.blockBreak(2)
+}
+
+// dropCap writes the drop cap n without breaking the line, so that it stays
+// attached to the rest of the word it starts.
+func (c *converter) dropCap(n *html.Node) {
+	if n.Data == "img" || n.Data == "image" {
+		if alt, ok := attr(n, "alt"); ok {
+			c.write(strings.TrimSpace(alt))
+		}
+		return
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.walk(child)
+	}
+}
+
+// centerSceneBreak centers the scene break line in width columns.
+func centerSceneBreak(line string, width int) string {
+	if width <= len(sceneBreak) {
+		return strings.TrimSpace(line)
+	}
+
+	return strings.Repeat(" ", (width-len(sceneBreak))/2) + sceneBreak
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands lists the commands copying their input to the clipboard,
+// the first one found being used.
+func clipboardCommands() [][]string {
+	switch {
+	case runtime.GOOS == "darwin":
+		return [][]string{{"pbcopy"}}
+	case runtime.GOOS == "windows":
+		return [][]string{{"clip"}}
+	case os.Getenv("WAYLAND_DISPLAY") != "":
+		return [][]string{{"wl-copy"}, {"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}}
+	default:
+		return [][]string{{"xclip", "-selection", "clipboard"}, {"xsel", "--clipboard", "--input"}, {"wl-copy"}}
+	}
+}
+
+// copyToClipboard copies text with the first clipboard command found,
+// reporting false if there is none.
+func copyToClipboard(text string) (bool, error) {
+	for _, command := range clipboardCommands() {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			continue
+		}
+
+		cmd := exec.Command(path, command[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		err = cmd.Run()
+		if err != nil {
+			return true, fmt.Errorf("%s: %s", command[0], err)
+		}
+		return true, nil
+	}
+
+	return false, nil
+}
+
+func clippingsFname() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "clippings.txt"), nil
+}
+
+// appendClipping appends text to the clippings file, after the book and
+// chapter it was copied from.
+func appendClipping(source, text string) (string, error) {
+	fname, err := clippingsFname()
+	if err != nil {
+		return "", err
+	}
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.OpenFile(fname, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return "", err
+	}
+	_, err = fmt.Fprintf(f, "%s\n%s\n\n", source, text)
+	if err != nil {
+		f.Close()
+		return "", err
+	}
+
+	return fname, f.Close()
+}
+
+// Yank copies the line at the top of the current chapter, or on the focus
+// line when shown, to the clipboard. Without a clipboard command, the line
+// is appended to the clippings file instead.
+func (b *Book) Yank() {
+	if b.Current == b.TOC.Index() {
+		return
+	}
+	c := b.Chapters[b.Current]
+
+	r := c.GetOffset()
+	if b.FocusLine {
+		r += b.focusLineOffset(c.height)
+	}
+	b.copyText(c, c.lineText(r))
+}
+
+// copyText copies text from the chapter c to the clipboard, or to the
+// clippings file without a clipboard command.
+func (b *Book) copyText(c *Chapter, text string) {
+	if text == "" {
+		b.Flash("nothing to copy")
+		return
+	}
+
+	found, err := copyToClipboard(text)
+	switch {
+	case err != nil:
+		b.Flash(fmt.Sprintf("copying: %s", err))
+	case found:
+		b.Flash("copied to the clipboard")
+	default:
+		fname, err := appendClipping(fmt.Sprintf("%s - %s", b.Title, c.title), text)
+		if err != nil {
+			b.Flash(fmt.Sprintf("no clipboard, saving to the clippings: %s", err))
+			return
+		}
+		b.Flash("no clipboard, added to " + fname)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"strings"
+)
+
+// ColumnGap is the number of blank columns between the two columns of text.
+const ColumnGap = 4
+
+// twoColumns reports whether chapters are shown in two columns: when turned
+// on with ToggleColumns, as long as the terminal is wide enough for both.
+func (b Book) twoColumns() bool {
+	if !b.Columns {
+		return false
+	}
+	_, _, available, _ := b.base.GetRect()
+
+	return available >= 2*b.Width+ColumnGap
+}
+
+// layoutColumns lays the chapters out in one or two columns, as twoColumns
+// reports. It is called after each draw, so that the layout follows the size
+// of the terminal.
+func (b *Book) layoutColumns() {
+	columns := b.twoColumns()
+	if columns == b.columns {
+		return
+	}
+	b.columns = columns
+
+	b.layoutChapters()
+	b.app.Draw()
+}
+
+// layoutChapters lays the chapters out again, in as many columns as last
+// laid out and with the current margin.
+func (b *Book) layoutChapters() {
+	for _, c := range b.Chapters {
+		c.columns = b.columns
+		if b.columns {
+			layoutChapter(c.g, b.margin(), c.t, c.right)
+		} else {
+			layoutChapter(c.g, b.margin(), c.t)
+		}
+		c.SetWidth(b.Width)
+	}
+}
+
+// ToggleColumns switches between one column of text and two side by side,
+// the text flowing from the bottom of the left column to the top of the
+// right one.
+func (b *Book) ToggleColumns() {
+	b.Columns = !b.Columns
+	switch {
+	case !b.Columns:
+		b.Flash("one column")
+	case !b.twoColumns():
+		b.Flash("two columns, once the terminal is wide enough")
+	default:
+		b.Flash("two columns")
+	}
+	b.layoutColumns()
+}
+
+// visibleLines returns the number of lines of the chapter shown at once,
+// over both columns.
+func (c Chapter) visibleLines() int {
+	if c.columns {
+		return 2 * c.height
+	}
+
+	return c.height
+}
+
+// setText sets the rendered text of the chapter, along with the line of it
+// each line of the text starts on and the width it was rendered for.
+func (c *Chapter) setText(text string, lineStarts []int, width int) {
+	c.t.SetText(text)
+	c.rendered = text
+	c.lineStarts = lineStarts
+	c.renderWidth = width
+	c.padding = -1
+}
+
+// syncColumns scrolls the right column to continue where the left one ends,
+// reporting whether it scrolled. The right column's text is padded with a
+// page of blank lines, so that it can be scrolled past the end of the text.
+func (c *Chapter) syncColumns() bool {
+	if !c.columns || !c.loaded {
+		return false
+	}
+	if c.padding != c.height {
+		c.right.SetText(c.rendered + strings.Repeat("\n", c.height))
+		c.padding = c.height
+	}
+
+	r := c.GetOffset() + c.height
+	if current, column := c.right.GetScrollOffset(); current == r && column == c.column {
+		return false
+	}
+	c.right.ScrollTo(r, c.column)
+
+	return true
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// printTOC writes the table of contents of each book to w, one chapter per
+// line with its number, title and URL separated by tabs. Lines are prefixed
+// with the file name when there are several books, like grep does.
+func printTOC(w io.Writer, fnames []string) error {
+	for _, fname := range fnames {
+		ebook, err := openBook(fname)
+		if err != nil {
+			return err
+		}
+
+		toc, err := ebook.TOC()
+		ebook.Close()
+		if err != nil {
+			return fmt.Errorf("%s: reading table of contents: %s", fname, err)
+		}
+		if fallback, ok := ebook.(*EBook); ok && fallback.FallbackTOC {
+			fmt.Fprintf(os.Stderr, "%s: notice: %s: no usable table of contents, listing chapters in reading order\n", filepath.Base(os.Args[0]), fname)
+		}
+
+		prefix := ""
+		if len(fnames) > 1 {
+			prefix = fname + "\t"
+		}
+		for i, entry := range toc {
+			_, err = fmt.Fprintf(w, "%s%d\t%s\t%s\n", prefix, i+1, entry.Name, entry.URL)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkBooks reads and converts every chapter of each book, writing one line
+// per chapter to w with its number, title and OK or the error, prefixed with
+// the file name like printTOC does. Books that can't be opened get a single
+// line. It fails if anything did.
+func checkBooks(w io.Writer, fnames []string) error {
+	failed := 0
+	for _, fname := range fnames {
+		ebook, err := openBook(fname)
+		if err != nil {
+			fmt.Fprintf(w, "%s\tERROR: %s\n", fname, err)
+			failed++
+			continue
+		}
+
+		toc, err := ebook.TOC()
+		if err != nil {
+			ebook.Close()
+			fmt.Fprintf(w, "%s\tERROR: reading table of contents: %s\n", fname, err)
+			failed++
+			continue
+		}
+		for i, entry := range toc {
+			status := "OK"
+			if _, err := ebook.ReadContent(entry.URL); err != nil {
+				status = "ERROR: " + err.Error()
+				failed++
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\t%s\n", fname, i+1, entry.Name, status)
+		}
+		ebook.Close()
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d errors", failed)
+	}
+
+	return nil
+}
+
+// resetStates removes the state files of the given books, writing the name
+// of each removed file to w. A book without state is an error.
+func resetStates(w io.Writer, fnames []string) error {
+	for _, fname := range fnames {
+		// the state may have been left next to the book before a state
+		// directory was set
+		states := []string{stateFname(fname)}
+		if sidecar := sidecarStateFname(fname); sidecar != states[0] {
+			states = append(states, sidecar)
+		}
+
+		removed := false
+		for _, state := range states {
+			err := os.Remove(state)
+			if os.IsNotExist(err) {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			removed = true
+			fmt.Fprintf(w, "removed %s\n", state)
+		}
+		if !removed {
+			return fmt.Errorf("%s: no saved state", fname)
+		}
+	}
+
+	return nil
+}
+
+// resetAllStates removes the state files of the books in the given
+// directories, writing the name of each removed file to w.
+func resetAllStates(w io.Writer, dirs []string) error {
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("%s: not a directory", dir)
+		}
+
+		states, err := filepath.Glob(filepath.Join(dir, ".*.lectern.json"))
+		if err != nil {
+			return err
+		}
+		if stateDir() != "" {
+			books, err := ioutil.ReadDir(dir)
+			if err != nil {
+				return err
+			}
+			for _, book := range books {
+				state := stateFname(filepath.Join(dir, book.Name()))
+				if _, err := os.Stat(state); err == nil {
+					states = append(states, state)
+				}
+			}
+		}
+		if len(states) == 0 {
+			fmt.Fprintf(os.Stderr, "%s: notice: %s: no saved state\n", filepath.Base(os.Args[0]), dir)
+		}
+		for _, state := range states {
+			err = os.Remove(state)
+			if err != nil {
+				return err
+			}
+			fmt.Fprintf(w, "removed %s\n", state)
+		}
+	}
+
+	return nil
+}
+
+// exportBook writes the text of the book to w, wrapped at width like the
+// reader shows it, each chapter starting with its title underlined. Only the
+// chapter selected by chapter is written when it isn't empty.
+func exportBook(w io.Writer, fname string, chapter string, width int) error {
+	ebook, err := openBook(fname)
+	if err != nil {
+		return err
+	}
+	defer ebook.Close()
+
+	toc, err := ebook.TOC()
+	if err != nil {
+		return fmt.Errorf("%s: reading table of contents: %s", fname, err)
+	}
+	selected, err := findChapter(toc, chapter)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fname, err)
+	}
+
+	for i, entry := range toc {
+		if selected != -1 && i != selected {
+			continue
+		}
+
+		text, err := ebook.ReadChapter(entry.URL)
+		if err != nil {
+			return fmt.Errorf("%s: reading chapter %q: %s", fname, entry.Name, err)
+		}
+
+		if i > 0 && selected == -1 {
+			fmt.Fprint(w, "\n\n")
+		}
+		fmt.Fprintf(w, "%s\n%s\n\n", entry.Name, strings.Repeat("=", tview.StringWidth(entry.Name)))
+		_, err = fmt.Fprintln(w, wrap(text, width))
+		if err != nil {
+			return err
+		}
+	}
+
+	return ebook.SaveCache()
+}
+
+// findChapter returns the index of the chapter selected by s, either its
+// number or text its title contains, ignoring case. It returns -1 when s is
+// empty, selecting every chapter.
+func findChapter(toc []TOCEntry, s string) (int, error) {
+	if s == "" {
+		return -1, nil
+	}
+	if n, err := strconv.Atoi(s); err == nil {
+		if n < 1 || n > len(toc) {
+			return 0, fmt.Errorf("no chapter %d, expected 1-%d", n, len(toc))
+		}
+		return n - 1, nil
+	}
+
+	for i, entry := range toc {
+		if strings.Contains(strings.ToLower(entry.Name), strings.ToLower(s)) {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("no chapter title containing %q", s)
+}
+
+// exportWidth returns the width to export the book at: the one given on the
+// command line, else the one saved while reading it.
+func exportWidth(fname string, opts Options) int {
+	if opts.widthSet {
+		return opts.Width
+	}
+	state, ok, err := LoadState(fname)
+	if err != nil || !ok || state.Width < MinWidth {
+		return opts.Width
+	}
+
+	return state.Width
+}
+
+// wrap wraps each line of text at width, breaking on words.
+func wrap(text string, width int) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+	for _, line := range lines {
+		if line == "" {
+			out = append(out, line)
+			continue
+		}
+		if strings.TrimSpace(line) == sceneBreak {
+			out = append(out, centerSceneBreak(line, width))
+			continue
+		}
+		for _, wrapped := range tview.WordWrap(line, width) {
+			out = append(out, strings.TrimRight(wrapped, " "))
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// printWordCounts writes the word and page counts of the book to w, using
+// the counts saved in its state when they are still valid.
+func printWordCounts(w io.Writer, fname string, ebook Reader, wordsPerPage int) error {
+	toc, err := ebook.TOC()
+	if err != nil {
+		return fmt.Errorf("%s: reading table of contents: %s", fname, err)
+	}
+
+	state, _, _ := LoadState(fname)
+	counts := state.Words
+	if !counts.Valid(fname, len(toc)) {
+		c, err := countBookWords(fname, ebook, toc)
+		if err != nil {
+			return fmt.Errorf("%s: counting words: %s", fname, err)
+		}
+		counts = &c
+	}
+
+	words := counts.Total()
+	fmt.Fprintf(w, "words: %d\n", words)
+	fmt.Fprintf(w, "pages: %d\n", pageCount(words, wordsPerPage))
+	for i, entry := range toc {
+		fmt.Fprintf(w, "chapter: %d. %s - %d words\n", i+1, entry.Name, counts.Chapters[i])
+	}
+
+	return nil
+}
+
+// infoFields are the Dublin Core metadata fields printed by printInfo.
+var infoFields = []string{
+	"title", "creator", "contributor", "publisher", "date",
+	"language", "identifier", "subject", "rights",
+}
+
+// printInfo writes the metadata of each book to w as "field: value" lines,
+// fields repeated for each of their values and omitted when missing,
+// followed by the book's word and page counts and the number of words of
+// each chapter. Books are separated by a blank line.
+func printInfo(w io.Writer, fnames []string, wordsPerPage int) error {
+	for i, fname := range fnames {
+		ebook, err := openBook(fname)
+		if err != nil {
+			return err
+		}
+
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "file: %s\n", fname)
+		for _, field := range infoFields {
+			values, err := ebook.Metadata(field)
+			if err != nil {
+				continue
+			}
+			for _, v := range values {
+				fmt.Fprintf(w, "%s: %s\n", field, strings.Join(strings.Fields(v), " "))
+			}
+		}
+
+		err = printWordCounts(w, fname, ebook, wordsPerPage)
+		ebook.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// Config is read from $XDG_CONFIG_HOME/lectern/config.json, for example:
+//
+//	{"Keys": {"quit": "Q"}, "WPM": 250, "Cover": true, "NightFrom": 21, "NightUntil": 7}
+type Config struct {
+	// Keys maps action names to the single character triggering them,
+	// overriding DefaultKeys.
+	Keys map[string]string
+	// WPM is the reading speed in words per minute, DefaultWPM when zero.
+	// The -wpm flag takes precedence.
+	WPM int
+	// WordsPerPage is the number of words in a page, for page estimates,
+	// DefaultWordsPerPage when zero.
+	WordsPerPage int
+	// Cover shows the title screen, with the book's cover, when opening a
+	// book for the first time.
+	Cover bool
+	// SkipFrontMatter opens books read for the first time at their first
+	// chapter that isn't front matter, like the cover or copyright pages,
+	// rather than at the table of contents.
+	SkipFrontMatter bool
+	// NightFrom and NightUntil are the hours between which night mode is
+	// turned on when opening a book, for example 21 and 7. Night mode is
+	// left as saved when they are equal.
+	NightFrom  int
+	NightUntil int
+	// Margin is the number of blank lines above and below the text.
+	Margin int
+	// ParagraphIndent is the number of spaces the first line of paragraphs
+	// is indented by, except after headings and scene breaks. Zero
+	// disables it.
+	ParagraphIndent int
+	// FocusLine marks a line of the text at FocusLinePosition, a fraction of
+	// its height, a third when zero, while the text scrolls past it.
+	FocusLine         bool
+	FocusLinePosition float64
+	// Scrollbar shows a scrollbar beside the text, with ticks at the marks
+	// and notes of the chapter.
+	Scrollbar bool
+	// ConfirmQuit asks for a confirmation before quitting.
+	ConfirmQuit bool
+	// ChapterHistory records moving to the next or previous chapter in the
+	// navigation history, along with following links and jumping to marks,
+	// notes and search matches.
+	ChapterHistory bool
+	// ScrollOff is the number of lines kept visible above the line jumped
+	// to, when jumping to a mark or a search match.
+	ScrollOff int
+	// ChapterSkip is the number of chapters skipped forward or backward at
+	// once, DefaultChapterSkip when zero.
+	ChapterSkip int
+	// Progress is "chapter" for the progress bar to show the position in
+	// the current chapter, the position in the book being shown otherwise.
+	Progress string
+	// SmoothScroll animates scrolling by pages, over SmoothScrollMillis
+	// milliseconds, DefaultScrollDuration when zero.
+	SmoothScroll       bool
+	SmoothScrollMillis int
+	// IdleTimeoutSeconds quits the reader, saving the state, when no key
+	// was pressed for this long. Zero disables it.
+	IdleTimeoutSeconds int
+	// DisableMouse turns mouse support off, for terminals where it
+	// misbehaves.
+	DisableMouse bool
+	// Hyphenate hyphenates the words that don't fit at the end of lines,
+	// with the hyphenation dictionary for the book's language, found in the
+	// usual directories like /usr/share/hyphen, or the libhyphen .dic file
+	// at HyphenationPatterns.
+	Hyphenate           bool
+	HyphenationPatterns string
+	// Dictionary is the command words are looked up with, like "sdcv -n",
+	// the word being appended to its arguments. dict or sdcv are used when
+	// empty.
+	Dictionary string
+	// CitationStyle is "markdown" for citations to be recorded in Markdown,
+	// "plain" by default.
+	CitationStyle string
+	// Typography turns straight quotes into curly ones, -- and --- into en
+	// and em dashes and ... into ellipses, and leaves at most one blank line
+	// between paragraphs, outside preformatted blocks.
+	Typography bool
+	// Transforms names the built-in transforms applied to the text of the
+	// chapters after conversion, in order, like "smartquotes" or
+	// "dedupe-blanklines". See Transforms for the list.
+	Transforms []string
+	// Classes maps CSS class names to the decoration of the elements having
+	// them, like "scene-break" or "drop-cap", adding to
+	// DefaultClassDecorations. An empty decoration removes a default one.
+	Classes map[string]string
+	// AutosaveSeconds is how often the reading state is saved while reading,
+	// DefaultAutosaveInterval when zero. Negative values disable autosaving.
+	AutosaveSeconds int
+}
+
+// DefaultChapterSkip is the number of chapters skipped at once when not
+// configured.
+const DefaultChapterSkip = 5
+
+// DefaultAutosaveInterval is how often the state is saved while reading, so
+// that the position and reading time survive the process being killed.
+const DefaultAutosaveInterval = time.Minute
+
+// ScrollDuration returns the configured duration of smooth scrolling.
+func (cfg Config) ScrollDuration() time.Duration {
+	if cfg.SmoothScrollMillis <= 0 {
+		return DefaultScrollDuration
+	}
+
+	return time.Duration(cfg.SmoothScrollMillis) * time.Millisecond
+}
+
+// AutosaveInterval returns the configured autosave interval, or 0 if
+// autosaving is disabled.
+func (cfg Config) AutosaveInterval() time.Duration {
+	switch {
+	case cfg.AutosaveSeconds < 0:
+		return 0
+	case cfg.AutosaveSeconds == 0:
+		return DefaultAutosaveInterval
+	default:
+		return time.Duration(cfg.AutosaveSeconds) * time.Second
+	}
+}
+
+func configDir() (string, error) {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".config")
+	}
+
+	return filepath.Join(dir, "lectern"), nil
+}
+
+func configFname() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// LoadConfig reads the user configuration. A missing config file isn't an
+// error, the defaults are used instead.
+func LoadConfig() (Config, error) {
+	var cfg Config
+
+	fname, err := configFname()
+	if err != nil {
+		return cfg, err
+	}
+
+	f, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		return cfg, nil
+	}
+	if err != nil {
+		return cfg, err
+	}
+	defer f.Close()
+
+	dec := json.NewDecoder(f)
+	err = dec.Decode(&cfg)
+	if err != nil {
+		return cfg, fmt.Errorf("%s: %s", fname, err)
+	}
+
+	return cfg, nil
+}
+
+// KeyMap merges the configured keys with DefaultKeys. Unknown action names,
+// invalid keys and keys bound to several actions are reported as warnings.
+// When a key conflicts, the explicitly configured action keeps it and the
+// other actions are left unbound.
+func (cfg Config) KeyMap() (map[string]rune, []string) {
+	var warnings []string
+
+	keys := map[string]rune{}
+	for name, r := range DefaultKeys {
+		keys[name] = r
+	}
+
+	configured := map[string]bool{}
+	for name, s := range cfg.Keys {
+		if _, ok := DefaultKeys[name]; !ok {
+			warnings = append(warnings, fmt.Sprintf("unknown action %q in key bindings", name))
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(s)
+		if r == utf8.RuneError || size != len(s) {
+			warnings = append(warnings, fmt.Sprintf("invalid key %q for action %q: must be a single character", s, name))
+			continue
+		}
+
+		keys[name] = r
+		configured[name] = true
+	}
+
+	byKey := map[rune][]string{}
+	for name, r := range keys {
+		byKey[r] = append(byKey[r], name)
+	}
+	for r, names := range byKey {
+		if len(names) < 2 {
+			continue
+		}
+		sort.Slice(names, func(i, j int) bool {
+			if configured[names[i]] != configured[names[j]] {
+				return configured[names[i]]
+			}
+			return names[i] < names[j]
+		})
+
+		for _, name := range names[1:] {
+			warnings = append(warnings, fmt.Sprintf("key %q bound to both %q and %q, leaving %q unbound", r, names[0], name, name))
+			delete(keys, name)
+		}
+	}
+	sort.Strings(warnings)
+
+	return keys, warnings
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	// image formats used for covers
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// Cover returns the cover image of the book, or nil if it has none. The cover
+// is the manifest item designated by the <meta name="cover"> element.
+func (b *EBook) Cover() (image.Image, error) {
+	metas, err := b.MetadataAttr("meta")
+	if err != nil {
+		return nil, nil
+	}
+
+	id := ""
+	for _, meta := range metas {
+		if meta["name"] == "cover" {
+			id = meta["content"]
+			break
+		}
+	}
+	if id == "" {
+		return nil, nil
+	}
+
+	r, err := b.OpenFileId(id)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	img, _, err := image.Decode(r)
+
+	return img, err
+}
+
+// Cover returns nil, text files have no cover.
+func (f *TextFile) Cover() (image.Image, error) {
+	return nil, nil
+}
+
+// drawImage draws img scaled to fit in the given area, keeping its aspect
+// ratio. Each cell shows two pixels stacked vertically, using the upper half
+// block character with the top pixel as foreground and the bottom one as
+// background.
+func drawImage(screen tcell.Screen, img image.Image, x, y, width, height int) {
+	bounds := img.Bounds()
+	iw, ih := bounds.Dx(), bounds.Dy()
+	if iw == 0 || ih == 0 || width == 0 || height == 0 {
+		return
+	}
+
+	scale := float64(width) / float64(iw)
+	if s := float64(2*height) / float64(ih); s < scale {
+		scale = s
+	}
+	w := int(float64(iw) * scale)
+	h := int(float64(ih)*scale) / 2
+	x += (width - w) / 2
+	y += (height - h) / 2
+
+	pixel := func(px, py int) tcell.Color {
+		c := img.At(
+			bounds.Min.X+int((float64(px)+0.5)/scale),
+			bounds.Min.Y+int((float64(py)+0.5)/scale),
+		)
+		r, g, b, _ := c.RGBA()
+		return tcell.NewRGBColor(int32(r>>8), int32(g>>8), int32(b>>8))
+	}
+
+	for cy := 0; cy < h; cy++ {
+		for cx := 0; cx < w; cx++ {
+			style := tcell.StyleDefault.
+				Foreground(pixel(cx, 2*cy)).
+				Background(pixel(cx, 2*cy+1))
+			screen.SetContent(x+cx, y+cy, '▀', nil, style)
+		}
+	}
+}
+
+// ShowInfo shows the title screen of the book, with its cover if it has one,
+// until a key is pressed.
+func (b *Book) ShowInfo() {
+	lines := []string{b.Title}
+	if authors, err := b.ebook.Metadata("creator"); err == nil && len(authors) > 0 {
+		lines = append(lines, "by "+strings.Join(authors, ", "))
+	}
+	summary := fmt.Sprintf("%d chapters", len(b.Chapters))
+	if counts, err := b.BookWordCounts(); err == nil {
+		words := counts.Total()
+		summary += fmt.Sprintf(", %d words, about %d pages", words, pageCount(words, b.WordsPerPage))
+	}
+	language := "Language: " + b.language
+	switch {
+	case b.language == "":
+		language += "detecting…"
+	case b.languageDetected:
+		language += " (detected)"
+	}
+	lines = append(lines, "", language, summary+" - press any key")
+
+	t := tview.NewTextView()
+	t.SetBackgroundColor(b.Theme.Background)
+	t.SetTextColor(b.Theme.Foreground)
+	t.SetTextAlign(tview.AlignCenter)
+	t.SetText(strings.Join(lines, "\n"))
+	t.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		b.HideOverlay()
+		return nil
+	})
+
+	g := tview.NewGrid()
+	g.SetColumns(-1, b.Width, -1)
+	g.SetBackgroundColor(b.Theme.Background)
+
+	cover, err := b.ebook.Cover()
+	if err != nil || cover == nil {
+		g.SetRows(-1, len(lines), -1)
+		g.AddItem(t, 1, 1, 1, 1, 0, 0, true)
+	} else {
+		box := tview.NewBox()
+		box.SetBackgroundColor(b.Theme.Background)
+		box.SetDrawFunc(func(screen tcell.Screen, x, y, width, height int) (int, int, int, int) {
+			drawImage(screen, cover, x, y, width, height)
+			return x, y, width, height
+		})
+		g.SetRows(1, -1, 1, len(lines))
+		g.AddItem(box, 1, 1, 1, 1, 0, 0, false)
+		g.AddItem(t, 3, 1, 1, 1, 0, 0, true)
+	}
+
+	if b.overlay != "" {
+		b.HideOverlay()
+	}
+	b.overlay = "info"
+	b.tPages.AddPage(b.overlay, g, true, true)
+	b.app.SetFocus(t)
+}
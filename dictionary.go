@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+	"unicode"
+)
+
+// dictionaryCommands lists the dictionary commands tried when none is
+// configured, the word being appended to their arguments.
+var dictionaryCommands = [][]string{
+	{"dict"},
+	{"sdcv", "--non-interactive"},
+}
+
+// dictionaryCommand returns the command looking up word, the configured one
+// or the first of dictionaryCommands found. It errors when the command isn't
+// installed.
+func (b Book) dictionaryCommand(word string) (*exec.Cmd, error) {
+	commands := dictionaryCommands
+	if b.Dictionary != "" {
+		commands = [][]string{strings.Fields(b.Dictionary)}
+	}
+
+	for _, command := range commands {
+		path, err := exec.LookPath(command[0])
+		if err != nil {
+			continue
+		}
+
+		args := append(append([]string{}, command[1:]...), word)
+		return exec.Command(path, args...), nil
+	}
+
+	if b.Dictionary != "" {
+		return nil, fmt.Errorf("%s not found", strings.Fields(b.Dictionary)[0])
+	}
+	return nil, fmt.Errorf("no dictionary: install dict or sdcv, or set Dictionary in the config file")
+}
+
+// trimWord removes the punctuation around a word.
+func trimWord(word string) string {
+	return strings.TrimFunc(word, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+// LookUp looks up the first word at the top of the current chapter, or on
+// the focus line when shown, in the dictionary.
+func (b *Book) LookUp() {
+	if b.Current == b.TOC.Index() {
+		return
+	}
+	c := b.Chapters[b.Current]
+
+	r := c.GetOffset()
+	if b.FocusLine {
+		r += b.focusLineOffset(c.height)
+	}
+	words := strings.Fields(c.lineText(r))
+	if len(words) == 0 {
+		b.Flash("nothing to look up")
+		return
+	}
+	b.lookUp(words[0])
+}
+
+// lookUp shows the definition of text in an overlay, once the dictionary
+// command is done.
+func (b *Book) lookUp(text string) {
+	word := trimWord(strings.Join(strings.Fields(text), " "))
+	if word == "" {
+		b.Flash("nothing to look up")
+		return
+	}
+
+	cmd, err := b.dictionaryCommand(word)
+	if err != nil {
+		b.Flash(err.Error())
+		return
+	}
+
+	b.Flash(fmt.Sprintf("looking up %q", word))
+	go func() {
+		out, err := cmd.CombinedOutput()
+		b.app.QueueUpdateDraw(func() {
+			definition := strings.TrimSpace(string(out))
+			switch {
+			case definition != "":
+				b.showNotes(word, definition)
+			case err != nil:
+				b.Flash(fmt.Sprintf("looking up %q: %s", word, err))
+			default:
+				b.Flash(fmt.Sprintf("no definition for %q", word))
+			}
+		})
+	}()
+}
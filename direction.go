@@ -0,0 +1,92 @@
+package main
+
+import (
+	"github.com/rivo/tview"
+)
+
+// Right-to-left support is limited to aligning the text to the right and
+// mirroring the arrow keys. Lines mixing left-to-right and right-to-left
+// scripts aren't reordered, that is left to the terminal's bidi support if
+// any, and the direction applies to the whole book rather than per
+// paragraph.
+
+// rtlLanguages are the language codes written right to left.
+var rtlLanguages = map[string]bool{
+	"ar": true, "dv": true, "fa": true, "he": true, "ku": true,
+	"ps": true, "sd": true, "ug": true, "ur": true, "yi": true,
+}
+
+// isRTLLanguage reports whether the language tag, like "ar" or "he-IL", is
+// for a language written right to left.
+func isRTLLanguage(tag string) bool {
+	return rtlLanguages[baseLanguage(tag)]
+}
+
+// IsRTL reports whether the chapter idx is shown right to left: as set with
+// ToggleRTL, else as detected from the book's language or the chapter's
+// markup.
+func (b Book) IsRTL(idx int) bool {
+	switch b.Direction {
+	case "rtl":
+		return true
+	case "ltr":
+		return false
+	}
+
+	return b.rtlLanguage || b.Chapters[idx].rtl
+}
+
+// applyDirection aligns the text of the chapter idx according to its
+// direction.
+func (b *Book) applyDirection(idx int) {
+	align := tview.AlignLeft
+	if b.IsRTL(idx) {
+		align = tview.AlignRight
+	}
+	b.Chapters[idx].t.SetTextAlign(align)
+	b.Chapters[idx].right.SetTextAlign(align)
+}
+
+// ToggleRTL switches the direction of the book, overriding the detected one.
+func (b *Book) ToggleRTL() {
+	idx := b.Current
+	if idx == b.TOC.Index() {
+		idx = b.menuContext
+	}
+
+	rtl := b.rtlLanguage
+	if idx >= 0 && idx < len(b.Chapters) {
+		rtl = b.IsRTL(idx)
+	}
+	if rtl {
+		b.Direction = "ltr"
+		b.Flash("left to right")
+	} else {
+		b.Direction = "rtl"
+		b.Flash("right to left")
+	}
+
+	for i := range b.Chapters {
+		b.applyDirection(i)
+	}
+}
+
+// ChapterRight goes to the chapter on the right, which is the next one unless
+// the current chapter is right to left.
+func (b *Book) ChapterRight() {
+	if b.Current != b.TOC.Index() && b.IsRTL(b.Current) {
+		b.PreviousChapter()
+		return
+	}
+	b.NextChapter()
+}
+
+// ChapterLeft goes to the chapter on the left, which is the previous one
+// unless the current chapter is right to left.
+func (b *Book) ChapterLeft() {
+	if b.Current != b.TOC.Index() && b.IsRTL(b.Current) {
+		b.NextChapter()
+		return
+	}
+	b.PreviousChapter()
+}
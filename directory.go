@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Directory is a book distributed as a directory of HTML files, like an
+// unzipped EPUB. The reading order is the spine of its package document when
+// it has one, its HTML files sorted by path otherwise. The table of contents
+// is read from its navigation document or its NCX, the files they don't
+// refer to being added in reading order.
+type Directory struct {
+	Title string
+
+	dir string
+	// urls are the paths of the HTML files relative to dir, with slashes
+	// like the chapter URLs, in reading order.
+	urls     []string
+	nav      string
+	ncx      string
+	cover    string
+	metadata map[string][]string
+
+	mu       sync.Mutex
+	contents map[string]Content
+}
+
+// NewDirectory opens the directory of HTML files dir as a book.
+func NewDirectory(dir string) (*Directory, error) {
+	d := &Directory{
+		Title:    filepath.Base(filepath.Clean(dir)),
+		dir:      dir,
+		metadata: map[string][]string{},
+		contents: map[string]Content{},
+	}
+
+	var files, packages, images []string
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if p != dir && strings.HasPrefix(info.Name(), ".") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch strings.ToLower(path.Ext(rel)) {
+		case ".html", ".htm", ".xhtml":
+			files = append(files, rel)
+		case ".opf":
+			packages = append(packages, rel)
+		case ".ncx":
+			if d.ncx == "" {
+				d.ncx = rel
+			}
+		case ".jpg", ".jpeg", ".png", ".gif":
+			images = append(images, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(packages) > 0 {
+		err = d.readPackage(packages[0])
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", packages[0], err)
+		}
+	}
+	if len(d.urls) == 0 {
+		sort.Strings(files)
+		for _, f := range files {
+			switch strings.ToLower(path.Base(f)) {
+			case "nav.xhtml", "nav.html", "nav.htm":
+				if d.nav == "" {
+					d.nav = f
+				}
+				continue
+			}
+			d.urls = append(d.urls, f)
+		}
+	}
+	if len(d.urls) == 0 {
+		return nil, fmt.Errorf("no HTML files")
+	}
+	if d.cover == "" {
+		for _, img := range images {
+			if strings.HasPrefix(strings.ToLower(path.Base(img)), "cover.") {
+				d.cover = img
+				break
+			}
+		}
+	}
+
+	return d, nil
+}
+
+// readPackage reads the metadata, the spine, the navigation documents and the
+// cover from the package document at opf.
+func (d *Directory) readPackage(opf string) error {
+	buf, err := d.ReadFile(opf)
+	if err != nil {
+		return err
+	}
+	var pkg struct {
+		Metadata struct {
+			Fields []struct {
+				XMLName xml.Name
+				Value   string `xml:",chardata"`
+				Name    string `xml:"name,attr"`
+				Content string `xml:"content,attr"`
+			} `xml:",any"`
+		} `xml:"metadata"`
+		Items []struct {
+			ID         string `xml:"id,attr"`
+			Href       string `xml:"href,attr"`
+			MediaType  string `xml:"media-type,attr"`
+			Properties string `xml:"properties,attr"`
+		} `xml:"manifest>item"`
+		ItemRefs []struct {
+			IDRef string `xml:"idref,attr"`
+		} `xml:"spine>itemref"`
+	}
+	err = xml.Unmarshal(buf, &pkg)
+	if err != nil {
+		return err
+	}
+
+	coverID := ""
+	for _, field := range pkg.Metadata.Fields {
+		if field.XMLName.Local == "meta" && field.Name == "cover" {
+			coverID = field.Content
+		}
+		if value := strings.TrimSpace(field.Value); value != "" {
+			d.metadata[field.XMLName.Local] = append(d.metadata[field.XMLName.Local], value)
+		}
+	}
+
+	hrefs := map[string]string{}
+	for _, item := range pkg.Items {
+		u, ok := resolveLink(opf, item.Href)
+		if !ok {
+			continue
+		}
+		hrefs[item.ID] = u
+		properties := " " + item.Properties + " "
+		switch {
+		case strings.Contains(properties, " nav "):
+			d.nav = u
+		case item.MediaType == "application/x-dtbncx+xml":
+			d.ncx = u
+		case item.ID == coverID || strings.Contains(properties, " cover-image "):
+			d.cover = u
+		}
+	}
+	for _, ref := range pkg.ItemRefs {
+		if u := hrefs[ref.IDRef]; u != "" {
+			d.urls = append(d.urls, u)
+		}
+	}
+
+	return nil
+}
+
+func (d *Directory) Metadata(field string) ([]string, error) {
+	if values := d.metadata[field]; len(values) > 0 {
+		return values, nil
+	}
+	if field == "title" {
+		return []string{d.Title}, nil
+	}
+
+	return nil, fmt.Errorf("metadata %q not found", field)
+}
+
+// TOC returns the table of contents from the navigation document, or else
+// the NCX, listing the HTML files they don't refer to along with them.
+func (d *Directory) TOC() ([]TOCEntry, error) {
+	var toc []TOCEntry
+	if d.nav != "" {
+		if buf, err := d.ReadFile(d.nav); err == nil {
+			toc, _ = navTOC(d.nav, buf)
+		}
+	}
+	if len(toc) == 0 && d.ncx != "" {
+		if buf, err := d.ReadFile(d.ncx); err == nil {
+			toc, _ = ncxTOC(d.ncx, buf)
+		}
+	}
+
+	return mergeReadingOrder(toc, d.urls, d.entry), nil
+}
+
+// entry returns the table of contents entry of the HTML file i at u.
+func (d *Directory) entry(i int, u string) TOCEntry {
+	name := ""
+	if buf, err := d.ReadFile(u); err == nil {
+		name = documentTitle(buf)
+	}
+	if name == "" {
+		name = fmt.Sprintf("Chapter %d", i+1)
+	}
+
+	return TOCEntry{
+		Name: name,
+		URL:  u,
+	}
+}
+
+func (d *Directory) ReadChapter(u string) (string, error) {
+	content, err := d.ReadContent(u)
+
+	return stripMarkup(content.Text), err
+}
+
+// ReadContent converts the HTML file at u, the conversion being kept for as
+// long as the book is open.
+func (d *Directory) ReadContent(u string) (Content, error) {
+	p := chapterPath(u)
+	d.mu.Lock()
+	content, ok := d.contents[p]
+	d.mu.Unlock()
+	if ok {
+		return content, nil
+	}
+
+	buf, err := d.ReadFile(p)
+	if err != nil {
+		return Content{}, fmt.Errorf("chapter %q not found", u)
+	}
+	content, err = convertHTML(p, buf)
+	if err != nil {
+		return Content{}, fmt.Errorf("%s: %s", p, err)
+	}
+
+	d.mu.Lock()
+	d.contents[p] = content
+	d.mu.Unlock()
+
+	return content, nil
+}
+
+// ReadFile reads the file at u relative to the directory, like the images
+// and the chapters.
+func (d *Directory) ReadFile(u string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(d.dir, filepath.FromSlash(chapterPath(u))))
+}
+
+// Cover returns the cover listed in the package document, or else the image
+// named cover, nil if there is neither.
+func (d *Directory) Cover() (image.Image, error) {
+	if d.cover == "" {
+		return nil, nil
+	}
+	f, err := os.Open(filepath.Join(d.dir, filepath.FromSlash(d.cover)))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+
+	return img, err
+}
+
+// SaveCache does nothing, the files are converted each time the book is
+// opened.
+func (d *Directory) SaveCache() error {
+	return nil
+}
+
+func (d *Directory) Close() {}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// The algorithms of META-INF/encryption.xml that only obfuscate embedded
+// fonts, as allowed for DRM-free books. The first bytes of the font are
+// XORed with a key derived from the book's unique identifier.
+const (
+	idpfObfuscation  = "http://www.idpf.org/2008/embedding"
+	adobeObfuscation = "http://ns.adobe.com/pdf/enc#RC"
+)
+
+// fontObfuscation maps the font obfuscation algorithms to the number of bytes
+// they obfuscate.
+var fontObfuscation = map[string]int{
+	idpfObfuscation:  1040,
+	adobeObfuscation: 1024,
+}
+
+// Encryption lists the resources of a book obfuscated with one of the
+// fontObfuscation algorithms.
+type Encryption struct {
+	// Identifier is the unique identifier of the book, the obfuscation
+	// keys are derived from.
+	Identifier string
+	// Obfuscated maps the URLs of the obfuscated resources, relative to the
+	// package document like the spine URLs, to their algorithm.
+	Obfuscated map[string]string
+}
+
+// readEncryption reads the encrypted resources of the book at fname. It
+// fails if any of its chapters is encrypted, which means it is protected by
+// DRM and would only show as garbage. The spine URLs are relative to the
+// package document, while the encrypted resources are listed relative to
+// the root of the archive.
+func readEncryption(fname string, spineURLs []string) (Encryption, error) {
+	var enc Encryption
+	z, err := zip.OpenReader(fname)
+	if err != nil {
+		return enc, err
+	}
+	defer z.Close()
+
+	found := false
+	for _, f := range z.File {
+		if f.Name == "META-INF/encryption.xml" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return enc, nil
+	}
+
+	var encryption struct {
+		Data []struct {
+			Method struct {
+				Algorithm string `xml:"Algorithm,attr"`
+			} `xml:"EncryptionMethod"`
+			Reference struct {
+				URI string `xml:"URI,attr"`
+			} `xml:"CipherData>CipherReference"`
+		} `xml:"EncryptedData"`
+	}
+	err = readZipXML(&z.Reader, "META-INF/encryption.xml", &encryption)
+	if err != nil {
+		return enc, fmt.Errorf("reading encryption.xml: %s", err)
+	}
+	opf, err := packagePath(&z.Reader)
+	if err != nil {
+		return enc, err
+	}
+
+	chapters := map[string]bool{}
+	for _, u := range spineURLs {
+		chapters[path.Join(path.Dir(opf), u)] = true
+	}
+	enc.Obfuscated = map[string]string{}
+	for _, data := range encryption.Data {
+		uri := data.Reference.URI
+		if unescaped, err := url.PathUnescape(uri); err == nil {
+			uri = unescaped
+		}
+		uri = path.Clean(uri)
+		if _, ok := fontObfuscation[data.Method.Algorithm]; ok {
+			enc.Obfuscated[relativeTo(path.Dir(opf), uri)] = data.Method.Algorithm
+			continue
+		}
+		if chapters[uri] {
+			return enc, fmt.Errorf("the book is protected by DRM (%s encrypts %s), it can't be read", data.Method.Algorithm, data.Reference.URI)
+		}
+	}
+	if len(enc.Obfuscated) > 0 {
+		enc.Identifier, err = uniqueIdentifier(&z.Reader, opf)
+		if err != nil {
+			return enc, err
+		}
+	}
+
+	return enc, nil
+}
+
+// relativeTo returns the path p of the archive relative to the directory dir.
+func relativeTo(dir, p string) string {
+	if dir == "." || dir == "" {
+		return p
+	}
+	dirs := strings.Split(dir, "/")
+	parts := strings.Split(p, "/")
+	common := 0
+	for common < len(dirs) && common < len(parts)-1 && dirs[common] == parts[common] {
+		common++
+	}
+
+	return strings.Repeat("../", len(dirs)-common) + strings.Join(parts[common:], "/")
+}
+
+// uniqueIdentifier returns the identifier the package document at opf
+// designates as the book's unique identifier.
+func uniqueIdentifier(z *zip.Reader, opf string) (string, error) {
+	var pkg struct {
+		UniqueIdentifier string `xml:"unique-identifier,attr"`
+		Identifiers      []struct {
+			ID    string `xml:"id,attr"`
+			Value string `xml:",chardata"`
+		} `xml:"metadata>identifier"`
+	}
+	err := readZipXML(z, opf, &pkg)
+	if err != nil {
+		return "", err
+	}
+	for _, id := range pkg.Identifiers {
+		if id.ID == pkg.UniqueIdentifier {
+			return id.Value, nil
+		}
+	}
+
+	return "", fmt.Errorf("unique identifier %q not found", pkg.UniqueIdentifier)
+}
+
+// obfuscationKey derives the key of the font obfuscation algorithm from the
+// unique identifier of the book: the SHA-1 of the identifier stripped of
+// whitespace for the IDPF algorithm, the bytes of the UUID it holds for the
+// Adobe one.
+func obfuscationKey(algorithm, identifier string) ([]byte, error) {
+	switch algorithm {
+	case idpfObfuscation:
+		stripped := strings.Map(func(r rune) rune {
+			switch r {
+			case ' ', '\t', '\r', '\n':
+				return -1
+			}
+			return r
+		}, identifier)
+		sum := sha1.Sum([]byte(stripped))
+		return sum[:], nil
+	case adobeObfuscation:
+		uuid := strings.TrimSpace(identifier)
+		uuid = strings.TrimPrefix(strings.TrimPrefix(uuid, "urn:uuid:"), "uuid:")
+		key, err := hex.DecodeString(strings.Replace(uuid, "-", "", -1))
+		if err != nil || len(key) != 16 {
+			return nil, fmt.Errorf("identifier %q isn't a UUID", identifier)
+		}
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unknown obfuscation algorithm %q", algorithm)
+}
+
+// deobfuscate returns the font buf obfuscated with the algorithm as it was
+// before being obfuscated. Obfuscating being a XOR, it also obfuscates.
+func deobfuscate(algorithm, identifier string, buf []byte) ([]byte, error) {
+	key, err := obfuscationKey(algorithm, identifier)
+	if err != nil {
+		return nil, err
+	}
+
+	out := append([]byte(nil), buf...)
+	for i := 0; i < fontObfuscation[algorithm] && i < len(out); i++ {
+		out[i] ^= key[i%len(key)]
+	}
+
+	return out, nil
+}
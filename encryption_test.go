@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testUUID = "urn:uuid:0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d"
+
+// testFont returns an OpenType font header followed by enough bytes to go
+// past the obfuscated ones.
+func testFont() []byte {
+	font := []byte("OTTO\x00\x0a\x00\x80")
+	for i := 0; len(font) < 2000; i++ {
+		font = append(font, byte(i))
+	}
+
+	return font
+}
+
+// obfuscate XORs the first n bytes of font with key, like the books
+// embedding obfuscated fonts do.
+func obfuscate(font, key []byte, n int) []byte {
+	out := append([]byte(nil), font...)
+	for i := 0; i < n; i++ {
+		out[i] ^= key[i%len(key)]
+	}
+
+	return out
+}
+
+func TestDeobfuscate(t *testing.T) {
+	idpfKey := sha1.Sum([]byte(testUUID))
+	adobeKey := []byte{0x0a, 0x1b, 0x2c, 0x3d, 0x4e, 0x5f, 0x6a, 0x7b, 0x8c, 0x9d, 0x0e, 0x1f, 0x2a, 0x3b, 0x4c, 0x5d}
+
+	for _, test := range []struct {
+		algorithm  string
+		identifier string
+		key        []byte
+		n          int
+	}{
+		// whitespace isn't part of the key
+		{idpfObfuscation, "\n  " + testUUID + "\n", idpfKey[:], 1040},
+		{adobeObfuscation, testUUID, adobeKey, 1024},
+	} {
+		t.Run(test.algorithm, func(t *testing.T) {
+			font := testFont()
+			obfuscated := obfuscate(font, test.key, test.n)
+			if bytes.HasPrefix(obfuscated, []byte("OTTO")) {
+				t.Fatal("header not obfuscated")
+			}
+
+			actual, err := deobfuscate(test.algorithm, test.identifier, obfuscated)
+			if err != nil {
+				t.Fatalf("deobfuscate: %s", err)
+			}
+			if !bytes.HasPrefix(actual, []byte("OTTO\x00\x0a\x00\x80")) {
+				t.Errorf("deobfuscated header = %q, expected an OpenType header", actual[:8])
+			}
+			if !bytes.Equal(actual, font) {
+				t.Error("deobfuscated font differs from the original")
+			}
+
+			again, err := deobfuscate(test.algorithm, test.identifier, actual)
+			if err != nil {
+				t.Fatalf("deobfuscate: %s", err)
+			}
+			if !bytes.Equal(again, obfuscated) {
+				t.Error("obfuscating the font again doesn't round trip")
+			}
+		})
+	}
+}
+
+func TestDeobfuscateNotUUID(t *testing.T) {
+	_, err := deobfuscate(adobeObfuscation, "isbn:9780000000000", testFont())
+	if err == nil {
+		t.Error("deobfuscate succeeded without a UUID")
+	}
+}
+
+// writeObfuscatedEPUB writes a book to dir embedding font obfuscated with
+// the IDPF algorithm.
+func writeObfuscatedEPUB(t *testing.T, dir string, font []byte) string {
+	idpfKey := sha1.Sum([]byte(testUUID))
+
+	return writeEPUB(t, dir, map[string]string{
+		"content.opf": fmt.Sprintf(`<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="uid">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Obfuscated</dc:title>
+    <dc:identifier id="isbn">isbn:9780000000000</dc:identifier>
+    <dc:identifier id="uid">%s</dc:identifier>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="one" href="one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="font" href="fonts/serif.otf" media-type="application/vnd.ms-opentype"/>
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="one"/>
+  </spine>
+</package>`, testUUID),
+		"toc.ncx": `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <navMap>
+    <navPoint id="p1" playOrder="1"><navLabel><text>One</text></navLabel><content src="one.xhtml"/></navPoint>
+  </navMap>
+</ncx>`,
+		"META-INF/encryption.xml": `<?xml version="1.0"?>
+<encryption xmlns="urn:oasis:names:tc:opendocument:xmlns:container" xmlns:enc="http://www.w3.org/2001/04/xmlenc#">
+  <enc:EncryptedData>
+    <enc:EncryptionMethod Algorithm="http://www.idpf.org/2008/embedding"/>
+    <enc:CipherData><enc:CipherReference URI="fonts/serif.otf"/></enc:CipherData>
+  </enc:EncryptedData>
+</encryption>`,
+		"fonts/serif.otf": string(obfuscate(font, idpfKey[:], 1040)),
+		"one.xhtml":       xhtml("One", `<h1>One</h1><p>Readable text.</p>`),
+	})
+}
+
+func TestReadEncryption(t *testing.T) {
+	dir, cleanup := tempStateDir(t)
+	defer cleanup()
+	fname := writeObfuscatedEPUB(t, dir, testFont())
+
+	enc, err := readEncryption(fname, []string{"one.xhtml"})
+	if err != nil {
+		t.Fatalf("readEncryption: %s", err)
+	}
+	expected := Encryption{
+		Identifier: testUUID,
+		Obfuscated: map[string]string{"fonts/serif.otf": idpfObfuscation},
+	}
+	if !reflect.DeepEqual(enc, expected) {
+		t.Errorf("readEncryption = %+v, expected %+v", enc, expected)
+	}
+}
+
+func TestEBookObfuscatedFont(t *testing.T) {
+	dir, cleanup := tempStateDir(t)
+	defer cleanup()
+	font := testFont()
+	fname := writeObfuscatedEPUB(t, dir, font)
+
+	ebook, err := NewEBook(fname)
+	if err != nil {
+		t.Fatalf("NewEBook: %s", err)
+	}
+	defer ebook.Close()
+
+	text, err := ebook.ReadChapter("one.xhtml")
+	if err != nil {
+		t.Fatalf("ReadChapter: %s", err)
+	}
+	if !strings.Contains(text, "Readable text.") {
+		t.Errorf("ReadChapter = %q, expected the chapter's text", text)
+	}
+
+	actual, err := ebook.ReadFile("fonts/serif.otf")
+	if err != nil {
+		t.Fatalf("ReadFile: %s", err)
+	}
+	if !bytes.Equal(actual, font) {
+		t.Errorf("ReadFile returned the font with the header %q, expected %q", actual[:8], font[:8])
+	}
+}
+
+func TestRelativeTo(t *testing.T) {
+	for _, test := range []struct {
+		dir, p   string
+		expected string
+	}{
+		{".", "fonts/serif.otf", "fonts/serif.otf"},
+		{"OEBPS", "OEBPS/fonts/serif.otf", "fonts/serif.otf"},
+		{"OEBPS", "fonts/serif.otf", "../fonts/serif.otf"},
+		{"OEBPS/text", "OEBPS/fonts/serif.otf", "../fonts/serif.otf"},
+	} {
+		if actual := relativeTo(test.dir, test.p); actual != test.expected {
+			t.Errorf("relativeTo(%q, %q) = %q, expected %q", test.dir, test.p, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"github.com/gdamore/tcell"
+)
+
+// DefaultFocusLinePosition is where the focus line is shown, as a fraction of
+// the height of the text, when not configured.
+const DefaultFocusLinePosition = 1.0 / 3
+
+// drawFocusLine marks the line at FocusLinePosition of the text's height,
+// which stays in place while the text scrolls past. The line is pointed at
+// from the margins in the accent color, or underlined when there is no room
+// for them, its text being left as is.
+func (b *Book) drawFocusLine(screen tcell.Screen) {
+	if !b.FocusLine || b.overlay != "" || b.Current == b.TOC.Index() {
+		return
+	}
+	x, y, width, height := b.Chapters[b.Current].t.GetRect()
+	if height == 0 {
+		return
+	}
+
+	y += b.focusLineOffset(height)
+
+	style := tcell.StyleDefault.Background(b.Theme.Background).Foreground(b.Theme.Accent)
+	screenWidth, _ := screen.Size()
+	last := x + width - 1
+	if b.columns {
+		last += width + ColumnGap
+	}
+	if x >= 2 && last+2 < screenWidth {
+		screen.SetContent(x-2, y, '▸', nil, style)
+		screen.SetContent(last+2, y, '◂', nil, style)
+		return
+	}
+
+	for cx := x; cx <= last; cx++ {
+		r, combining, cellStyle, _ := screen.GetContent(cx, y)
+		screen.SetContent(cx, y, r, combining, cellStyle.Underline(true))
+	}
+}
+
+// focusLineOffset returns the line of the focus line, from the top of text
+// height lines high.
+func (b Book) focusLineOffset(height int) int {
+	position := b.FocusLinePosition
+	if position <= 0 || position >= 1 {
+		position = DefaultFocusLinePosition
+	}
+
+	return int(position * float64(height))
+}
+
+// ToggleFocusLine shows or hides the focus line.
+func (b *Book) ToggleFocusLine() {
+	b.FocusLine = !b.FocusLine
+}
+
+// layoutBase lays out the title, the text, the progress bar and the status
+// bar, leaving out the title and the progress bar in focus mode.
+func (b *Book) layoutBase() {
+	b.base.Clear()
+	if b.FocusMode {
+		b.base.SetRows(-1, 1)
+		b.base.AddItem(b.tPages, 0, 0, 1, 1, 0, 0, true)
+		b.base.AddItem(b.status, 1, 0, 1, 1, 0, 0, false)
+		return
+	}
+
+	b.base.SetRows(2, -1, 1, 1)
+	b.base.AddItem(b.title, 0, 0, 1, 1, 0, 0, false)
+	b.base.AddItem(b.tPages, 1, 0, 1, 1, 0, 0, true)
+	b.base.AddItem(b.progress, 2, 0, 1, 1, 0, 0, false)
+	b.base.AddItem(b.status, 3, 0, 1, 1, 0, 0, false)
+}
+
+// ToggleFocusMode hides or shows the title and the progress bar. The text
+// keeps its position, as when the terminal is resized.
+func (b *Book) ToggleFocusMode() {
+	b.FocusMode = !b.FocusMode
+	b.layoutBase()
+}
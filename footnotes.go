@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// ShowFootnotes lists the footnotes of the current chapter in an overlay.
+func (b *Book) ShowFootnotes() {
+	if b.Current == b.TOC.Index() {
+		return
+	}
+
+	c := b.Chapters[b.Current]
+	if len(c.footnotes) == 0 {
+		b.Flash("no footnotes in this chapter")
+		return
+	}
+
+	notes := make([]string, len(c.footnotes))
+	for i, note := range c.footnotes {
+		notes[i] = fmt.Sprintf("%d. %s", i+1, note.Text)
+	}
+	b.showNotes("Footnotes", strings.Join(notes, "\n\n"))
+}
+
+// footnote returns the footnote with the given id in the chapter idx, if it
+// is loaded.
+func (b Book) footnote(idx int, id string) (Footnote, bool) {
+	for _, note := range b.Chapters[idx].footnotes {
+		if note.ID != "" && note.ID == id {
+			return note, true
+		}
+	}
+
+	return Footnote{}, false
+}
+
+func (b *Book) showNotes(title, text string) {
+	t := newOverlayText(b.Theme, title, tview.Escape(text))
+	t.SetDynamicColors(true)
+	t.SetWrap(true)
+	t.SetWordWrap(true)
+	t.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp, tcell.KeyDown, tcell.KeyPgUp, tcell.KeyPgDn, tcell.KeyHome, tcell.KeyEnd:
+			return event
+		}
+		b.HideOverlay()
+		return nil
+	})
+
+	height := b.PageHeight()
+	if height < 3 {
+		height = 3
+	}
+	b.ShowOverlay("footnotes", t, b.Width, height)
+}
@@ -0,0 +1,317 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxSpacing is the maximum number of blank lines added between paragraphs.
+const MaxSpacing = 3
+
+// RefreshChapter re-renders the chapter's text, applying the formatting
+// options and search highlights, while keeping the scroll position.
+func (b *Book) RefreshChapter(c *Chapter) {
+	if !c.loaded {
+		return
+	}
+
+	r := c.GetOffset()
+	text, lineStarts := b.render(c.Index(), c.text)
+	c.setText(text, lineStarts, b.Width)
+	c.t.ScrollTo(r, c.column)
+	b.placeMarks(c)
+}
+
+// placeMarks moves the marks and notes of the chapter to the line as shown
+// their line of the text now starts on, unless they are still within it. The
+// marks and notes saved by older versions get their line of the text from
+// their line as shown.
+func (b *Book) placeMarks(c *Chapter) {
+	place := func(r, line int) (int, int) {
+		if line < 0 {
+			return r, c.sourceLine(r)
+		}
+		if c.sourceLine(r) != line {
+			r = c.sourceRow(line)
+		}
+		return r, line
+	}
+
+	for name, m := range b.Marks {
+		if m.Chapter == c.Index() {
+			m.Line, m.SourceLine = place(m.Line, m.SourceLine)
+			b.Marks[name] = m
+		}
+	}
+	for i, n := range b.Notes {
+		if n.Chapter == c.Index() {
+			b.Notes[i].Line, b.Notes[i].SourceLine = place(n.Line, n.SourceLine)
+		}
+	}
+}
+
+// render turns the text of the chapter idx into the content of its TextView.
+// Each line of the text is a paragraph, formatted and highlighted on its own
+// so that search matches keep referring to the lines of the text. The lines
+// of preformatted blocks are neither formatted nor spaced out. With
+// LineNumbers, each line is prefixed with its number in the text, and with
+// ParagraphIndent the first line of paragraphs is indented. It also returns
+// the line of the rendered text each line of the text starts on.
+func (b *Book) render(idx int, text string) (string, []int) {
+	code := b.Chapters[idx].code
+	lines := strings.Split(text, "\n")
+	gutter := 0
+	if b.LineNumbers {
+		gutter = len(strconv.Itoa(len(lines))) + 1
+	}
+
+	out := make([]string, 0, len(lines))
+	lineStarts := make([]int, len(lines))
+	rendered := 0
+	previous := ""
+	for i, line := range lines {
+		if i > 0 && line != "" && !(code[i] && code[i-1]) {
+			for j := 0; j < b.Spacing; j++ {
+				out = append(out, "")
+			}
+			rendered += b.Spacing
+		}
+		source := line
+		if !code[i] {
+			if b.ParagraphIndent > 0 && isIndented(line, previous) {
+				line = strings.Repeat(" ", b.ParagraphIndent) + line
+			}
+			line = b.format(line, b.Width-gutter, gutter > 0)
+		}
+		if strings.TrimSpace(source) != "" {
+			previous = source
+		}
+		line = b.highlight(idx, i, source, line)
+		if gutter > 0 && line != "" {
+			line = numberLine(line, i+1, gutter)
+		}
+		out = append(out, line)
+		lineStarts[i] = rendered
+		rendered += strings.Count(line, "\n") + 1
+	}
+
+	return strings.Join(out, "\n"), lineStarts
+}
+
+// isIndented reports whether the line is a paragraph of prose whose first
+// line is indented, the previous non-blank line being previous. Headings,
+// list items, scene breaks, indented blocks and the paragraphs following a
+// heading or a scene break, or starting the chapter, aren't.
+func isIndented(line, previous string) bool {
+	if !isProse(line) {
+		return false
+	}
+
+	return previous != "" && (isProse(previous) || strings.HasPrefix(previous, " "))
+}
+
+// isProse reports whether the line is a paragraph starting at the left
+// edge, not a heading, a list item or a scene break.
+func isProse(line string) bool {
+	if line == "" || strings.TrimLeft(line, " ") != line || line == sceneBreak {
+		return false
+	}
+	if strings.HasPrefix(line, "#") || strings.HasPrefix(line, "• ") {
+		return false
+	}
+	if i := strings.Index(line, ". "); i > 0 {
+		if _, err := strconv.Atoi(line[:i]); err == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// numberLine prefixes the line with its number, right-aligned in a gutter of
+// the given width. The lines it was broken into are indented to the same
+// column.
+func numberLine(line string, n, gutter int) string {
+	parts := strings.Split(line, "\n")
+	parts[0] = fmt.Sprintf("%*d %s", gutter-1, n, parts[0])
+	for i := 1; i < len(parts); i++ {
+		parts[i] = strings.Repeat(" ", gutter) + parts[i]
+	}
+
+	return strings.Join(parts, "\n")
+}
+
+func (b *Book) RefreshChapters() {
+	for _, c := range b.Chapters {
+		b.RefreshChapter(c)
+	}
+}
+
+// format applies the formatting options to a line of the chapter text, to be
+// shown width columns wide. Scene breaks are centered. With breaks, the line
+// is broken at width even if it isn't justified or hyphenated, rather than
+// being left to the TextView to wrap, so that the line number gutter can be
+// kept clear.
+func (b Book) format(text string, width int, breaks bool) string {
+	if strings.TrimSpace(text) == sceneBreak {
+		return centerSceneBreak(text, width)
+	}
+	var h *Hyphenator
+	if b.Hyphenate {
+		h = b.hyphenator
+	}
+	if b.Justify || h != nil || breaks {
+		text = breakLines(text, width, h, b.Justify)
+	}
+
+	return text
+}
+
+// ToggleLineNumbers shows or hides the number of each line of the text,
+// keeping the current chapter at the same position.
+func (b *Book) ToggleLineNumbers() {
+	b.LineNumbers = !b.LineNumbers
+
+	var c *Chapter
+	f := -1.0
+	if b.Current != b.TOC.Index() {
+		c = b.Chapters[b.Current]
+		f = c.Fraction()
+	}
+	b.RefreshChapters()
+	if c != nil && f >= 0 {
+		c.SetFraction(f)
+	}
+}
+
+// ToggleJustify turns justified text on or off.
+func (b *Book) ToggleJustify() {
+	b.Justify = !b.Justify
+	b.RefreshChapters()
+}
+
+// breakLines wraps each line of text at width, keeping the indentation of
+// its first line. Words that don't fit at the end of a line are hyphenated
+// with h, unless nil. When justified, the wrapped lines are padded with
+// spaces between words so that both edges are aligned, the last line of each
+// paragraph and lines holding a single word being left as is.
+func breakLines(text string, width int, h *Hyphenator, justified bool) string {
+	lines := strings.Split(text, "\n")
+	out := make([]string, 0, len(lines))
+
+	for _, line := range lines {
+		words := strings.Fields(line)
+		if len(words) == 0 {
+			out = append(out, line)
+			continue
+		}
+
+		indent := line[:len(line)-len(strings.TrimLeft(line, " "))]
+		wrapped, widths := wrapWords(words, width, len(indent), h)
+		for i, words := range wrapped {
+			prefix, lineWidth := "", width
+			if i == 0 {
+				prefix, lineWidth = indent, width-len(indent)
+			}
+			if justified && i < len(wrapped)-1 {
+				out = append(out, prefix+justifyLine(words, widths[i], lineWidth))
+				continue
+			}
+			out = append(out, prefix+strings.Join(words, " "))
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// wrapWords splits words into lines at most width wide, the first one being
+// indented by indent columns, returning the words of each line and its
+// width, without the indentation. Words longer than width are left on a line
+// of their own unless they can be hyphenated with h.
+func wrapWords(words []string, width, indent int, h *Hyphenator) ([][]string, []int) {
+	var lines [][]string
+	var widths []int
+	var line []string
+	lineWidth := 0
+	flush := func() {
+		lines = append(lines, line)
+		widths = append(widths, lineWidth)
+		line, lineWidth = nil, 0
+		indent = 0
+	}
+
+	for len(words) > 0 {
+		word := words[0]
+		room := width - indent - lineWidth
+		if len(line) > 0 {
+			room--
+		}
+
+		w := textWidth(word)
+		if w <= room || len(line) == 0 && h == nil {
+			line = append(line, word)
+			lineWidth = width - indent - room + w
+			words = words[1:]
+			continue
+		}
+		if h != nil {
+			if first, rest, ok := h.hyphenate(word, room); ok {
+				line = append(line, first)
+				lineWidth = width - indent - room + textWidth(first)
+				words[0] = rest
+				flush()
+				continue
+			}
+		}
+		if len(line) == 0 {
+			// too long and can't be hyphenated
+			line = append(line, word)
+			lineWidth = w
+			words = words[1:]
+		}
+		flush()
+	}
+	if len(line) > 0 {
+		flush()
+	}
+
+	return lines, widths
+}
+
+// justifyLine joins words, distributing the width-lineWidth extra spaces
+// between them, the leftmost gaps getting the remainder.
+func justifyLine(words []string, lineWidth, width int) string {
+	if len(words) < 2 || lineWidth >= width {
+		return strings.Join(words, " ")
+	}
+
+	gaps := len(words) - 1
+	extra := width - lineWidth
+
+	var out strings.Builder
+	for i, word := range words {
+		out.WriteString(word)
+		if i == gaps {
+			break
+		}
+
+		spaces := 1 + extra/gaps
+		if i < extra%gaps {
+			spaces++
+		}
+		out.WriteString(strings.Repeat(" ", spaces))
+	}
+
+	return out.String()
+}
+
+func (b *Book) SetSpacing(spacing int) {
+	if spacing < 0 || spacing > MaxSpacing {
+		return
+	}
+
+	b.Spacing = spacing
+	b.RefreshChapters()
+	b.Flash(fmt.Sprintf("paragraph spacing: %d", spacing))
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatNumberedLine(t *testing.T) {
+	b := Book{Width: 24}
+	line := "The quick brown fox jumps over the lazy dog, and then the quick brown fox runs away."
+	gutter := 3
+
+	rows := strings.Split(numberLine(b.format(line, b.Width-gutter, true), 12, gutter), "\n")
+	if len(rows) < 2 {
+		t.Fatalf("line not broken: %q", rows)
+	}
+	if !strings.HasPrefix(rows[0], "12 The") {
+		t.Errorf("first row = %q, expected it to start with the line number", rows[0])
+	}
+	for _, row := range rows[1:] {
+		if !strings.HasPrefix(row, "   ") || row[gutter] == ' ' {
+			t.Errorf("row %q isn't indented past the gutter", row)
+		}
+	}
+	for _, row := range rows {
+		if textWidth(row) > b.Width {
+			t.Errorf("row %q is wider than %d", row, b.Width)
+		}
+	}
+}
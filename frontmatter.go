@@ -0,0 +1,50 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// frontMatterTitles are the titles, or words in titles, of the chapters
+// skipped when opening a book for the first time.
+var frontMatterTitles = []string{
+	"cover", "title page", "titlepage", "half title", "copyright",
+	"dedication", "contents", "epigraph", "colophon",
+}
+
+// minContentWords is the number of words under which a leading chapter is
+// considered front matter, like a cover image or a copyright notice.
+const minContentWords = 50
+
+// firstContentChapter returns the index of the first chapter that isn't front
+// matter, or -1 if there is none.
+func firstContentChapter(r Reader, toc []TOCEntry) int {
+	for i, entry := range toc {
+		if !isFrontMatter(r, entry) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// isFrontMatter reports whether the chapter is front matter, from its title
+// or from how little text it holds. Chapters that can't be read aren't.
+func isFrontMatter(r Reader, entry TOCEntry) bool {
+	words := strings.FieldsFunc(strings.ToLower(entry.Name), func(c rune) bool {
+		return !unicode.IsLetter(c)
+	})
+	title := " " + strings.Join(words, " ") + " "
+	for _, t := range frontMatterTitles {
+		if strings.Contains(title, " "+t+" ") {
+			return true
+		}
+	}
+
+	text, err := r.ReadChapter(entry.URL)
+	if err != nil {
+		return false
+	}
+
+	return countWords(text) < minContentWords
+}
@@ -4,11 +4,10 @@ go 1.12
 
 require (
 	github.com/gdamore/tcell v1.3.0
-	github.com/k3a/html2text v0.0.0-20190714173509-955615037597
 	github.com/meskio/epubgo v0.0.0-20160213181628-90dd5d78197f
 	github.com/rivo/tview v0.0.0-20190721135419-23dc8a0944e4
 	github.com/smartystreets/goconvey v0.0.0-20190731233626-505e41936337 // indirect
-	golang.org/x/net v0.22.0 // indirect
+	golang.org/x/net v0.22.0
 )
 
 replace github.com/rivo/tview => ./tview
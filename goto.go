@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gdamore/tcell"
+)
+
+// StartGoto arms the goto prefix: typing the goto key again scrolls to the
+// start of the chapter, like vim's gg, while digits start the number of the
+// chapter to go to. Any other key disarms it.
+func (b *Book) StartGoto() {
+	b.message = "go to chapter: "
+	b.pending = func(event *tcell.EventKey) {
+		switch {
+		case event.Key() == tcell.KeyRune && event.Rune() == b.key("goto_chapter"):
+			b.message = ""
+			b.ScrollToTop()
+		case event.Key() == tcell.KeyRune && event.Rune() >= '0' && event.Rune() <= '9':
+			b.promptNumber("go to chapter: ", b.GoToChapterNumber)
+			handle := b.pending
+			handle(event)
+		default:
+			b.message = ""
+		}
+	}
+}
+
+// promptNumber reads a number in the status bar, calling commit with the
+// digits typed once enter is pressed. Any other key cancels.
+func (b *Book) promptNumber(prompt string, commit func(string)) {
+	b.numberInput = ""
+	b.message = prompt
+
+	var handle func(event *tcell.EventKey)
+	handle = func(event *tcell.EventKey) {
+		switch {
+		case event.Key() == tcell.KeyEnter:
+			b.message = ""
+			commit(b.numberInput)
+		case event.Key() == tcell.KeyRune && event.Rune() >= '0' && event.Rune() <= '9':
+			b.numberInput += string(event.Rune())
+			b.message = prompt + b.numberInput
+			b.pending = handle
+		case event.Key() == tcell.KeyBackspace || event.Key() == tcell.KeyBackspace2:
+			if len(b.numberInput) > 0 {
+				b.numberInput = b.numberInput[:len(b.numberInput)-1]
+			}
+			b.message = prompt + b.numberInput
+			b.pending = handle
+		default:
+			b.message = ""
+		}
+	}
+	b.pending = handle
+}
+
+// GoToChapterNumber goes to the chapter numbered s, starting from 1.
+func (b *Book) GoToChapterNumber(s string) {
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > len(b.Chapters) {
+		b.Flash(fmt.Sprintf("no chapter %q, expected 1-%d", s, len(b.Chapters)))
+		return
+	}
+
+	b.recordJump()
+	b.OpenChapter(n - 1)
+}
@@ -0,0 +1,83 @@
+package main
+
+// MaxHistory is the number of positions kept in the navigation history.
+const MaxHistory = 100
+
+// historyEntry is a position in the navigation history: a chapter and the
+// line at the top of the screen.
+type historyEntry struct {
+	Chapter int
+	Line    int
+}
+
+// currentPosition returns the position in the current chapter, reporting
+// false on the table of contents.
+func (b Book) currentPosition() (historyEntry, bool) {
+	if b.Current == b.TOC.Index() {
+		return historyEntry{}, false
+	}
+
+	return historyEntry{Chapter: b.Current, Line: b.Chapters[b.Current].GetOffset()}, true
+}
+
+// recordJump adds the current position to the navigation history before
+// jumping away from it, to a link, a mark, a note or a search match. The
+// positions gone back from are dropped, as in a browser.
+func (b *Book) recordJump() {
+	p, ok := b.currentPosition()
+	if !ok {
+		return
+	}
+
+	b.history = b.history[:b.historyAt]
+	if n := len(b.history); n == 0 || b.history[n-1] != p {
+		b.history = append(b.history, p)
+	}
+	if len(b.history) > MaxHistory {
+		b.history = b.history[len(b.history)-MaxHistory:]
+	}
+	b.historyAt = len(b.history)
+}
+
+// HistoryBack goes back to the position jumped from, the current one being
+// kept to go forward to.
+func (b *Book) HistoryBack() {
+	if b.historyAt == 0 {
+		b.Flash("no older position in the history")
+		return
+	}
+	if b.historyAt == len(b.history) {
+		if p, ok := b.currentPosition(); ok {
+			b.history = append(b.history, p)
+		}
+		if n := len(b.history) - MaxHistory; n > 0 {
+			b.history = b.history[n:]
+			b.historyAt -= n
+		}
+	}
+
+	b.historyAt--
+	b.goToHistory(b.history[b.historyAt])
+}
+
+// HistoryForward goes forward to the position gone back from.
+func (b *Book) HistoryForward() {
+	if b.historyAt+1 >= len(b.history) {
+		b.Flash("no newer position in the history")
+		return
+	}
+
+	b.historyAt++
+	b.goToHistory(b.history[b.historyAt])
+}
+
+func (b *Book) goToHistory(p historyEntry) {
+	if p.Chapter < 0 || p.Chapter >= len(b.Chapters) {
+		return
+	}
+
+	b.Chapters[p.Chapter].ScrollToLine(p.Line, 0)
+	if b.Current != p.Chapter {
+		b.GoToPage(p.Chapter)
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestHistoryBackMaxHistory(t *testing.T) {
+	b := newTestBook(nil, []TOCEntry{{Name: "One", URL: "one.xhtml"}})
+	b.Current = 0
+	for i := 0; i < MaxHistory; i++ {
+		b.Chapters[0].SetOffset(i)
+		b.recordJump()
+	}
+	if len(b.history) != MaxHistory {
+		t.Fatalf("%d positions recorded, expected %d", len(b.history), MaxHistory)
+	}
+
+	b.Chapters[0].SetOffset(MaxHistory)
+	b.HistoryBack()
+	if len(b.history) != MaxHistory {
+		t.Errorf("%d positions in the history, expected at most %d", len(b.history), MaxHistory)
+	}
+	if p := b.history[b.historyAt]; p.Line != MaxHistory-1 {
+		t.Errorf("went back to line %d, expected %d", p.Line, MaxHistory-1)
+	}
+	if offset := b.Chapters[0].GetOffset(); offset != MaxHistory-1 {
+		t.Errorf("scrolled to line %d, expected %d", offset, MaxHistory-1)
+	}
+
+	b.HistoryForward()
+	if offset := b.Chapters[0].GetOffset(); offset != MaxHistory {
+		t.Errorf("went forward to line %d, expected %d", offset, MaxHistory)
+	}
+}
@@ -0,0 +1,552 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+)
+
+// Content is the text of a chapter converted from its HTML.
+type Content struct {
+	Text string
+	// Links holds the chapter's internal links, the link numbered n in the
+	// text being Links[n-1].
+	Links []Link
+	// Anchors maps the ids of the chapter's elements to the line of the text
+	// they start on.
+	Anchors map[string]int
+	// Footnotes holds the chapter's footnotes, in order of appearance.
+	Footnotes []Footnote
+	// RTL is set when the document is marked as written right to left.
+	RTL bool
+	// Preformatted holds the lines of the text inside preformatted blocks,
+	// in order.
+	Preformatted []int
+}
+
+type Footnote struct {
+	ID   string
+	Text string
+}
+
+type Link struct {
+	// Target is the URL the link points to, relative to the root of the book
+	// like the chapter URLs, including the fragment if any.
+	Target string
+	// Line is the line of the text the link's marker is on.
+	Line int
+	// Image is set for the links added to image placeholders, Target being
+	// the image's URL.
+	Image bool
+}
+
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"dd": true, "div": true, "dl": true, "dt": true, "fieldset": true,
+	"figcaption": true, "figure": true, "footer": true, "form": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"header": true, "hr": true, "li": true, "main": true, "nav": true,
+	"ol": true, "p": true, "pre": true, "section": true, "table": true,
+	"tr": true, "ul": true,
+}
+
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "title": true,
+}
+
+// converter accumulates the text of a chapter while walking its HTML tree.
+type converter struct {
+	u string
+
+	out     strings.Builder
+	line    int
+	col     int
+	breaks  int
+	space   bool
+	pre     int
+	code    []int
+	links   []Link
+	anchors map[string]int
+
+	// indent is written at the start of each line, for blockquotes and
+	// list items, lists holding the number of the next item of each list
+	// being walked, -1 for unordered lists.
+	indent string
+	lists  []int
+	// marker is set while nothing was written after a list item marker, so
+	// that a paragraph opening the item stays on the marker's line.
+	marker bool
+
+	// noteIDs holds the ids targeted by the chapter's footnote references.
+	noteIDs   map[string]bool
+	footnotes []Footnote
+}
+
+// convertHTML converts the HTML of the chapter at the given URL to text,
+// numbering its internal links, and applies the configured transforms.
+func convertHTML(u string, buf []byte) (Content, error) {
+	doc, err := html.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return Content{}, err
+	}
+
+	root := findElement(doc, "body")
+	if root == nil {
+		root = doc
+	}
+	c := &converter{
+		u:       chapterPath(u),
+		anchors: map[string]int{},
+		noteIDs: map[string]bool{},
+	}
+	findNoteRefs(root, c.noteIDs)
+	c.walk(root)
+
+	content := Content{
+		Text:         c.String(),
+		Links:        c.links,
+		Anchors:      c.anchors,
+		Footnotes:    c.footnotes,
+		RTL:          isRTLDocument(doc, root),
+		Preformatted: c.code,
+	}
+
+	return applyTransforms(content, textTransforms), nil
+}
+
+func (c *converter) String() string {
+	return strings.TrimRight(c.out.String(), " \n")
+}
+
+// isRTLDocument reports whether the html or body element of the document has
+// a right-to-left dir attribute.
+func isRTLDocument(doc, body *html.Node) bool {
+	for _, n := range []*html.Node{findElement(doc, "html"), body} {
+		if n == nil {
+			continue
+		}
+		if dir, ok := attr(n, "dir"); ok && strings.ToLower(dir) == "rtl" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// documentTitle returns the text of the first h1 to h3 heading of an HTML
+// document, or of its title element when it has no heading.
+func documentTitle(buf []byte) string {
+	doc, err := html.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return ""
+	}
+
+	for _, name := range []string{"h1", "h2", "h3", "title"} {
+		if n := findElement(doc, name); n != nil {
+			if title := textContent(n); title != "" {
+				return title
+			}
+		}
+	}
+
+	return ""
+}
+
+// textContent returns the text under n, with whitespace collapsed.
+func textContent(n *html.Node) string {
+	var parts []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			parts = append(parts, n.Data)
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(n)
+
+	return strings.Join(strings.Fields(strings.Join(parts, "")), " ")
+}
+
+func findElement(n *html.Node, name string) *html.Node {
+	if n.Type == html.ElementNode && n.Data == name {
+		return n
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		if found := findElement(child, name); found != nil {
+			return found
+		}
+	}
+
+	return nil
+}
+
+func attr(n *html.Node, key string) (string, bool) {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val, true
+		}
+	}
+
+	return "", false
+}
+
+// hasType reports whether the space-separated epub:type or role attribute
+// of n contains one of the given types.
+func hasType(n *html.Node, types ...string) bool {
+	for _, key := range []string{"epub:type", "role"} {
+		v, ok := attr(n, key)
+		if !ok {
+			continue
+		}
+		for _, field := range strings.Fields(v) {
+			for _, t := range types {
+				if field == t || field == "doc-"+t {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// findNoteRefs collects the ids targeted by the footnote references under n.
+func findNoteRefs(n *html.Node, ids map[string]bool) {
+	if n.Type == html.ElementNode && n.Data == "a" && hasType(n, "noteref") {
+		href, _ := attr(n, "href")
+		if strings.HasPrefix(href, "#") {
+			ids[href[1:]] = true
+		}
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		findNoteRefs(child, ids)
+	}
+}
+
+func (c *converter) isFootnote(n *html.Node) bool {
+	if hasType(n, "footnote", "endnote", "rearnote") {
+		return true
+	}
+	id, ok := attr(n, "id")
+
+	return ok && c.noteIDs[id]
+}
+
+// footnote converts the content of the footnote n on its own.
+func (c *converter) footnote(n *html.Node) {
+	id, _ := attr(n, "id")
+	note := &converter{
+		u:       c.u,
+		anchors: map[string]int{},
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		note.walk(child)
+	}
+
+	c.footnotes = append(c.footnotes, Footnote{
+		ID:   id,
+		Text: stripMarkup(note.String()),
+	})
+}
+
+func (c *converter) walk(n *html.Node) {
+	switch n.Type {
+	case html.TextNode:
+		c.text(n.Data)
+		return
+	case html.ElementNode, html.DocumentNode:
+	default:
+		return
+	}
+	if skippedElements[n.Data] {
+		return
+	}
+
+	if id, ok := attr(n, "id"); ok {
+		c.anchors[id] = c.nextLine()
+	}
+	if name, ok := attr(n, "name"); ok && n.Data == "a" {
+		c.anchors[name] = c.nextLine()
+	}
+	if c.noteIDs != nil && c.isFootnote(n) {
+		c.footnote(n)
+		if n.Data == "aside" {
+			// asides are popups in EPUB readers, only shown on demand
+			return
+		}
+	}
+
+	decoration := decoration(n)
+	switch decoration {
+	case "hidden":
+		return
+	case "scene-break":
+		c.writeSceneBreak()
+		return
+	case "drop-cap":
+		c.dropCap(n)
+		return
+	case "quote":
+		c.blockBreak(2)
+	}
+
+	switch {
+	case n.Data == "br":
+		c.lineBreak()
+		return
+	case n.Data == "img" || n.Data == "image":
+		c.image(n)
+		return
+	case n.Data == "p" || n.Data == "pre" || n.Data == "blockquote":
+		c.blockBreak(2)
+	case isHeading(n.Data):
+		c.blockBreak(2)
+		c.write(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+	case blockElements[n.Data]:
+		c.blockBreak(1)
+	case n.Data == "td" || n.Data == "th":
+		c.space = true
+	}
+
+	indent := c.indent
+	switch n.Data {
+	case "pre":
+		c.pre++
+	case "blockquote":
+		c.indent += "    "
+	case "ul":
+		c.lists = append(c.lists, -1)
+	case "ol":
+		start := 1
+		if v, ok := attr(n, "start"); ok {
+			fmt.Sscanf(v, "%d", &start)
+		}
+		c.lists = append(c.lists, start)
+	case "li":
+		c.listItem()
+	}
+	if decoration == "quote" {
+		c.indent += "    "
+	}
+	marker, emphasized := emphasisElements[n.Data]
+	switch decoration {
+	case "emphasis":
+		marker, emphasized = emphasisStart, true
+	case "strong":
+		marker, emphasized = strongStart, true
+	}
+	if emphasized {
+		c.write(string(marker))
+	}
+
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.walk(child)
+	}
+
+	if emphasized {
+		// the end marker follows its start one
+		c.write(string(marker + 1))
+	}
+	c.indent = indent
+	switch n.Data {
+	case "pre":
+		c.pre--
+	case "ul", "ol":
+		c.lists = c.lists[:len(c.lists)-1]
+	}
+
+	switch {
+	case n.Data == "a":
+		c.link(n)
+	case n.Data == "p" || n.Data == "pre" || n.Data == "blockquote" || isHeading(n.Data) || decoration == "quote":
+		c.blockBreak(2)
+	case blockElements[n.Data]:
+		c.blockBreak(1)
+	}
+}
+
+// listItem writes the bullet or number of a list item, the lines of the item
+// being indented past it.
+func (c *converter) listItem() {
+	marker := "• "
+	if len(c.lists) > 0 {
+		if n := c.lists[len(c.lists)-1]; n != -1 {
+			marker = fmt.Sprintf("%d. ", n)
+			c.lists[len(c.lists)-1]++
+		}
+	}
+
+	c.write(marker)
+	c.marker = true
+	c.indent += strings.Repeat(" ", utf8.RuneCountInString(marker))
+}
+
+// image writes a placeholder for the image n, showing its alt text or title,
+// numbered like links so that the image can be opened.
+func (c *converter) image(n *html.Node) {
+	label := "image"
+	for _, key := range []string{"alt", "title"} {
+		if v, ok := attr(n, key); ok && strings.TrimSpace(v) != "" {
+			label = strings.Join(strings.Fields(v), " ")
+			break
+		}
+	}
+
+	c.write("[" + label + "]")
+
+	src, ok := attr(n, "src")
+	if !ok {
+		src, ok = attr(n, "xlink:href")
+	}
+	if !ok {
+		src, ok = attr(n, "href")
+	}
+	if !ok {
+		return
+	}
+	if target, ok := resolveLink(c.u, src); ok {
+		c.addLink(Link{Target: target, Image: true})
+	}
+}
+
+func isHeading(name string) bool {
+	return len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6'
+}
+
+// link appends the numbered marker of an internal link after its text.
+func (c *converter) link(n *html.Node) {
+	href, ok := attr(n, "href")
+	if !ok {
+		return
+	}
+	target, ok := resolveLink(c.u, href)
+	if !ok {
+		return
+	}
+
+	c.addLink(Link{Target: target})
+}
+
+// addLink numbers the link, writing its marker.
+func (c *converter) addLink(link Link) {
+	link.Line = c.nextLine()
+	c.links = append(c.links, link)
+	c.write(fmt.Sprintf("[%d]", len(c.links)))
+}
+
+// resolveLink resolves href relative to the chapter at u, reporting false for
+// links leading outside of the book.
+func resolveLink(u, href string) (string, bool) {
+	if href == "" || strings.Contains(href, ":") {
+		return "", false
+	}
+	if strings.HasPrefix(href, "#") {
+		return u + href, true
+	}
+
+	return path.Join(path.Dir(u), href), true
+}
+
+// blockBreak asks for n line breaks before the next text, leaving n-1 blank
+// lines, without adding up with the breaks already asked for.
+func (c *converter) blockBreak(n int) {
+	if c.marker {
+		return
+	}
+	if c.breaks < n {
+		c.breaks = n
+	}
+}
+
+// lineBreak ends the current line, consecutive breaks leaving blank lines.
+func (c *converter) lineBreak() {
+	c.breaks++
+}
+
+// nextLine returns the line the next text will be written on.
+func (c *converter) nextLine() int {
+	if c.out.Len() == 0 || c.breaks == 0 {
+		return c.line
+	}
+	if c.col == 0 {
+		return c.line + c.breaks - 1
+	}
+
+	return c.line + c.breaks
+}
+
+func (c *converter) text(s string) {
+	if c.pre > 0 {
+		c.write(s)
+		return
+	}
+
+	start := -1
+	for i, r := range s {
+		switch {
+		case unicode.IsSpace(r):
+			if start != -1 {
+				c.write(s[start:i])
+				start = -1
+			}
+			c.space = true
+		case start == -1:
+			start = i
+		}
+	}
+	if start != -1 {
+		c.write(s[start:])
+	}
+}
+
+// write writes s after the pending line breaks or space.
+func (c *converter) write(s string) {
+	if s == "" {
+		return
+	}
+
+	if c.breaks > 0 && c.out.Len() > 0 {
+		n := c.breaks
+		if c.col == 0 {
+			n--
+		}
+		c.out.WriteString(strings.Repeat("\n", n))
+		c.line += n
+		c.col = 0
+	} else if c.space && c.col > 0 {
+		c.out.WriteString(" ")
+		c.col++
+	}
+	c.breaks = 0
+	c.space = false
+	c.marker = false
+	if c.col == 0 && c.indent != "" {
+		c.out.WriteString(c.indent)
+		c.col += len(c.indent)
+	}
+
+	start := c.line
+	c.out.WriteString(s)
+	if i := strings.LastIndex(s, "\n"); i != -1 {
+		c.line += strings.Count(s, "\n")
+		c.col = len(s) - i - 1
+	} else {
+		c.col += len(s)
+	}
+	if c.pre == 0 {
+		return
+	}
+	if len(c.code) > 0 && c.code[len(c.code)-1] == start {
+		start++
+	}
+	for line := start; line <= c.line; line++ {
+		c.code = append(c.code, line)
+	}
+}
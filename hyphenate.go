@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MinHyphenatedLength is the length, in characters, under which words are
+// never hyphenated.
+const MinHyphenatedLength = 6
+
+// hyphenationDirs are searched for the hyphenation dictionary of the book's
+// language, in the libhyphen format used by LibreOffice.
+var hyphenationDirs = []string{
+	"/usr/share/hyphen",
+	"/usr/local/share/hyphen",
+	"/usr/share/myspell/dicts",
+	"/usr/share/hunspell",
+	"/Library/Spelling",
+}
+
+// Hyphenator finds where words can be hyphenated, with Liang's algorithm.
+type Hyphenator struct {
+	// patterns maps the letters of each pattern to its values, the value
+	// at i applying between letters i-1 and i.
+	patterns map[string][]int
+	longest  int
+
+	leftMin  int
+	rightMin int
+}
+
+// LoadHyphenator reads a hyphenation dictionary in the libhyphen format: the
+// character set on the first line, then one pattern per line.
+func LoadHyphenator(fname string) (*Hyphenator, error) {
+	f, err := os.Open(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := &Hyphenator{
+		patterns: map[string][]int{},
+		leftMin:  2,
+		rightMin: 3,
+	}
+	s := bufio.NewScanner(f)
+	if !s.Scan() {
+		return nil, fmt.Errorf("%s: empty hyphenation dictionary", fname)
+	}
+	latin1 := false
+	switch charset := strings.ToUpper(strings.TrimSpace(s.Text())); charset {
+	case "UTF-8":
+	case "ISO8859-1":
+		latin1 = true
+	default:
+		return nil, fmt.Errorf("%s: unsupported character set %q", fname, charset)
+	}
+
+	for s.Scan() {
+		line := s.Text()
+		if latin1 {
+			line = fromLatin1(line)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "%") || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		switch fields[0] {
+		case "LEFTHYPHENMIN", "RIGHTHYPHENMIN":
+			if len(fields) > 1 {
+				if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+					if fields[0] == "LEFTHYPHENMIN" {
+						h.leftMin = n
+					} else {
+						h.rightMin = n
+					}
+				}
+			}
+			continue
+		case "COMPOUNDLEFTHYPHENMIN", "COMPOUNDRIGHTHYPHENMIN", "NOHYPHEN":
+			continue
+		case "NEXTLEVEL":
+			// the patterns for compound words follow
+			return h, s.Err()
+		}
+		if strings.ContainsAny(fields[0], "/=") {
+			// non-standard hyphenation, changing the letters around it
+			continue
+		}
+		h.add(fields[0])
+	}
+
+	return h, s.Err()
+}
+
+func fromLatin1(s string) string {
+	runes := make([]rune, len(s))
+	for i := 0; i < len(s); i++ {
+		runes[i] = rune(s[i])
+	}
+
+	return string(runes)
+}
+
+// add adds a pattern like "a1b2c", its digits being the values between its
+// letters.
+func (h *Hyphenator) add(pattern string) {
+	var letters []rune
+	values := []int{0}
+	for _, r := range pattern {
+		if r >= '0' && r <= '9' {
+			values[len(values)-1] = int(r - '0')
+			continue
+		}
+		letters = append(letters, r)
+		values = append(values, 0)
+	}
+
+	h.patterns[string(letters)] = values
+	if len(letters) > h.longest {
+		h.longest = len(letters)
+	}
+}
+
+// Points returns the positions, in characters, at which word can be
+// hyphenated.
+func (h *Hyphenator) Points(word string) []int {
+	letters := []rune("." + strings.ToLower(word) + ".")
+	n := len(letters) - 2
+	if n < MinHyphenatedLength {
+		return nil
+	}
+
+	values := make([]int, len(letters)+1)
+	for i := range letters {
+		for j := i + 1; j <= len(letters) && j-i <= h.longest; j++ {
+			pattern, ok := h.patterns[string(letters[i:j])]
+			if !ok {
+				continue
+			}
+			for k, v := range pattern {
+				if v > values[i+k] {
+					values[i+k] = v
+				}
+			}
+		}
+	}
+
+	var points []int
+	for k := h.leftMin; k <= n-h.rightMin; k++ {
+		// the value between the letters k-1 and k of the word, offset by
+		// the leading dot
+		if values[k+1]%2 == 1 {
+			points = append(points, k)
+		}
+	}
+
+	return points
+}
+
+// hyphenationFname returns the hyphenation dictionary for the language tag,
+// like hyph_en_US.dic for en-US, or for any region of the language when
+// there is none for the exact tag.
+func hyphenationFname(language string) (string, error) {
+	parts := strings.SplitN(strings.Replace(language, "_", "-", -1), "-", 2)
+	lang := strings.ToLower(parts[0])
+	if lang == "" {
+		return "", fmt.Errorf("no hyphenation dictionary: the book's language is unknown")
+	}
+
+	names := []string{"hyph_" + lang + ".dic"}
+	if len(parts) == 2 {
+		names = append([]string{"hyph_" + lang + "_" + strings.ToUpper(parts[1]) + ".dic"}, names...)
+	}
+	for _, dir := range hyphenationDirs {
+		for _, name := range names {
+			fname := filepath.Join(dir, name)
+			if _, err := os.Stat(fname); err == nil {
+				return fname, nil
+			}
+		}
+	}
+	for _, dir := range hyphenationDirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, "hyph_"+lang+"_*.dic"))
+		if len(matches) > 0 {
+			return matches[0], nil
+		}
+	}
+
+	return "", fmt.Errorf("no hyphenation dictionary for %q, set HyphenationPatterns in the config file", language)
+}
+
+// loadHyphenator loads the hyphenation dictionary, the configured one or the
+// one for the book's language, if not loaded yet.
+func (b *Book) loadHyphenator() error {
+	if b.hyphenator != nil {
+		return nil
+	}
+
+	fname := b.HyphenationPatterns
+	if fname == "" {
+		var err error
+		fname, err = hyphenationFname(b.language)
+		if err != nil {
+			return err
+		}
+	}
+	h, err := LoadHyphenator(fname)
+	if err != nil {
+		return err
+	}
+	b.hyphenator = h
+
+	return nil
+}
+
+// ToggleHyphenation turns the hyphenation of the words that don't fit at the
+// end of lines on or off.
+func (b *Book) ToggleHyphenation() {
+	if !b.Hyphenate {
+		err := b.loadHyphenator()
+		if err != nil {
+			b.Flash(err.Error())
+			return
+		}
+	}
+
+	b.Hyphenate = !b.Hyphenate
+	b.RefreshChapters()
+}
+
+// hyphenate splits word at the last hyphenation point leaving a first part
+// at most width wide, hyphen included, reporting false if there is none.
+// The positions of the formatting markers are kept.
+func (h *Hyphenator) hyphenate(word string, width int) (string, string, bool) {
+	stripped := stripMarkup(word)
+	if strings.ContainsAny(stripped, "-‐") {
+		// compound words are only broken at their own hyphens
+		return "", "", false
+	}
+	start := strings.IndexFunc(stripped, unicode.IsLetter)
+	end := strings.LastIndexFunc(stripped, unicode.IsLetter)
+	if start == -1 {
+		return "", "", false
+	}
+	_, size := utf8.DecodeRuneInString(stripped[end:])
+	prefix := utf8.RuneCountInString(stripped[:start])
+	points := h.Points(stripped[start : end+size])
+
+	for i := len(points) - 1; i >= 0; i-- {
+		at := prefix + points[i]
+		if at+1 > width {
+			continue
+		}
+
+		// at counts characters of the stripped word, markers are skipped
+		// to find where to split word
+		count := 0
+		for j, r := range word {
+			if isMarkup(r) {
+				continue
+			}
+			if count == at {
+				return word[:j] + "-", word[j:], true
+			}
+			count++
+		}
+	}
+
+	return "", "", false
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"runtime"
+)
+
+// viewerCommand returns the command opening files with the platform's
+// default application.
+func viewerCommand() string {
+	if runtime.GOOS == "darwin" {
+		return "open"
+	}
+
+	return "xdg-open"
+}
+
+// OpenImage extracts the image at u from the book to a temporary file and
+// opens it in the platform's image viewer. The file is removed when the book
+// is closed.
+func (b *Book) OpenImage(u string) {
+	viewer, err := exec.LookPath(viewerCommand())
+	if err != nil {
+		b.Flash(fmt.Sprintf("no image viewer: %s not found", viewerCommand()))
+		return
+	}
+
+	buf, err := b.ebook.ReadFile(u)
+	if err != nil {
+		b.Flash(fmt.Sprintf("reading image: %s", err))
+		return
+	}
+
+	f, err := ioutil.TempFile("", "lectern-*"+path.Ext(chapterPath(u)))
+	if err != nil {
+		b.Flash(fmt.Sprintf("extracting image: %s", err))
+		return
+	}
+	b.tempFiles = append(b.tempFiles, f.Name())
+	_, err = f.Write(buf)
+	if err != nil {
+		f.Close()
+		b.Flash(fmt.Sprintf("extracting image: %s", err))
+		return
+	}
+	err = f.Close()
+	if err != nil {
+		b.Flash(fmt.Sprintf("extracting image: %s", err))
+		return
+	}
+
+	cmd := exec.Command(viewer, f.Name())
+	err = cmd.Start()
+	if err != nil {
+		b.Flash(fmt.Sprintf("opening image: %s", err))
+		return
+	}
+	// reap the viewer once it exits
+	go cmd.Wait()
+}
+
+// removeTempFiles removes the files extracted by OpenImage.
+func (b *Book) removeTempFiles() {
+	for _, fname := range b.tempFiles {
+		os.Remove(fname)
+	}
+	b.tempFiles = nil
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+type Binding struct {
+	Name        string
+	Key         rune
+	Description string
+	Action      func()
+}
+
+// DefaultKeys maps action names to their key, unless overridden in the config
+// file.
+var DefaultKeys = map[string]rune{
+	"quit":             'q',
+	"help":             '?',
+	"command":          ':',
+	"next_chapter":     'l',
+	"previous_chapter": 'h',
+	"skip_forward":     '}',
+	"skip_back":        '{',
+	"toggle_menu":      '/',
+	"peek_toc":         'T',
+	"menu_down":        'j',
+	"menu_up":          'k',
+	"filter_toc":       'F',
+	"set_mark":         'm',
+	"jump_to_mark":     '\'',
+	"list_marks":       'M',
+	"add_note":         'a',
+	"list_notes":       'A',
+	"next_mark":        '"',
+	"next_unread":      'U',
+	"goto_chapter":     'g',
+	"search":           's',
+	"next_match":       'n',
+	"previous_match":   'N',
+	"jump_scroll":      ' ',
+	"jump_scroll_back": 'B',
+	"half_page_down":   'd',
+	"half_page_up":     'u',
+	"page_down":        'f',
+	"page_up":          'b',
+	"widen":            '+',
+	"narrow":           '-',
+	"reset_width":      '=',
+	"zoom_in":          ')',
+	"zoom_out":         '(',
+	"cycle_theme":      't',
+	"toggle_justify":   'J',
+	"hyphenation":      'H',
+	"line_numbers":     '#',
+	"library":          'L',
+	"footnotes":        'o',
+	"stats":            'S',
+	"info":             'i',
+	"toggle_night":     'z',
+	"bottom":           'G',
+	"less_spacing":     '[',
+	"more_spacing":     ']',
+	"toggle_rtl":       'R',
+	"toggle_wrap":      'W',
+	"toggle_columns":   'C',
+	"focus_line":       '|',
+	"scrollbar":        'P',
+	"focus_mode":       'Z',
+	"yank":             'y',
+	"visual":           'v',
+	"look_up":          'K',
+	"cite":             'c',
+	"scroll_right":     '>',
+	"scroll_left":      '<',
+}
+
+// Bindings lists every action the reader reacts to with its key, which is 0
+// for unbound actions. It is the single source for both the input handling
+// and the help overlay.
+func (b *Book) Bindings() []Binding {
+	bindings := []Binding{
+		{Name: "quit", Description: "quit", Action: b.Quit},
+		{Name: "help", Description: "show this help", Action: b.ShowHelp},
+		{Name: "command", Description: "run a command by name, like goto 12, search foo, width 90, theme night or export", Action: b.ShowCommand},
+		{Name: "next_chapter", Description: "next chapter", Action: b.NextChapter},
+		{Name: "previous_chapter", Description: "previous chapter", Action: b.PreviousChapter},
+		{Name: "skip_forward", Description: fmt.Sprintf("skip %d chapters forward", b.chapterSkip()), Action: func() { b.SkipChapters(b.chapterSkip()) }},
+		{Name: "skip_back", Description: fmt.Sprintf("skip %d chapters backward", b.chapterSkip()), Action: func() { b.SkipChapters(-b.chapterSkip()) }},
+		{Name: "toggle_menu", Description: "toggle the table of contents", Action: b.ToggleMenu},
+		{Name: "peek_toc", Description: "glance at the table of contents, returning to the same position after a moment", Action: b.PeekTOC},
+		{Name: "menu_down", Description: "move down in the table of contents", Action: b.MenuDown},
+		{Name: "menu_up", Description: "move up in the table of contents", Action: b.MenuUp},
+		{Name: "filter_toc", Description: "filter the table of contents", Action: b.FilterTOC},
+		{Name: "set_mark", Description: "set a mark, followed by a letter", Action: func() { b.pending = runeHandler(b.SetMark) }},
+		{Name: "jump_to_mark", Description: "jump to a mark, followed by a letter", Action: func() { b.pending = runeHandler(b.JumpToMark) }},
+		{Name: "goto_chapter", Description: "go to a chapter, followed by its number and enter, or go to the start of the chapter when typed twice", Action: b.StartGoto},
+		{Name: "bottom", Description: "go to the end of the chapter", Action: b.ScrollToBottom},
+		{Name: "list_marks", Description: "list marks", Action: b.ShowMarks},
+		{Name: "add_note", Description: "add a note at the current position", Action: b.ShowAddNote},
+		{Name: "list_notes", Description: "list notes", Action: b.ShowNotes},
+		{Name: "next_mark", Description: "jump to the next mark in the book", Action: b.NextMark},
+		{Name: "next_unread", Description: "go to the next chapter not read to the end", Action: b.NextUnreadChapter},
+		{Name: "search", Description: "search the book", Action: b.ShowSearch},
+		{Name: "next_match", Description: "next search match", Action: b.NextMatch},
+		{Name: "previous_match", Description: "previous search match", Action: b.PreviousMatch},
+		{Name: "jump_scroll", Description: "scroll forward", Action: b.JumpScroll},
+		{Name: "jump_scroll_back", Description: "scroll backward", Action: b.JumpScrollBack},
+		{Name: "half_page_down", Description: "scroll down half a page", Action: b.HalfPageDown},
+		{Name: "half_page_up", Description: "scroll up half a page", Action: b.HalfPageUp},
+		{Name: "page_down", Description: "scroll down a page", Action: b.PageDown},
+		{Name: "page_up", Description: "scroll up a page", Action: b.PageUp},
+		{Name: "widen", Description: "widen the text", Action: func() { b.SetWidth(b.Width + 5) }},
+		{Name: "narrow", Description: "narrow the text", Action: func() { b.SetWidth(b.Width + -5) }},
+		{Name: "reset_width", Description: "reset the text width", Action: func() { b.SetWidth(80) }},
+		{Name: "zoom_in", Description: "zoom in: narrow the text and widen the margins", Action: func() { b.SetZoom(b.Zoom + 1) }},
+		{Name: "zoom_out", Description: "zoom out: widen the text and narrow the margins", Action: func() { b.SetZoom(b.Zoom - 1) }},
+		{Name: "cycle_theme", Description: "switch to the next color theme", Action: b.CycleTheme},
+		{Name: "toggle_justify", Description: "toggle justified text", Action: b.ToggleJustify},
+		{Name: "hyphenation", Description: "toggle the hyphenation of words not fitting at the end of lines", Action: b.ToggleHyphenation},
+		{Name: "line_numbers", Description: "toggle line numbers", Action: b.ToggleLineNumbers},
+		{Name: "less_spacing", Description: "decrease the spacing between paragraphs", Action: func() { b.SetSpacing(b.Spacing - 1) }},
+		{Name: "more_spacing", Description: "increase the spacing between paragraphs", Action: func() { b.SetSpacing(b.Spacing + 1) }},
+		{Name: "toggle_rtl", Description: "toggle right-to-left text", Action: b.ToggleRTL},
+		{Name: "toggle_wrap", Description: "toggle line wrapping, off by default for chapters that are mostly code", Action: b.ToggleWrap},
+		{Name: "toggle_columns", Description: "toggle two columns of text, on terminals wide enough", Action: b.ToggleColumns},
+		{Name: "focus_line", Description: "toggle a marker on a fixed line of the screen", Action: b.ToggleFocusLine},
+		{Name: "scrollbar", Description: "toggle the scrollbar showing the marks and notes of the chapter", Action: b.ToggleScrollbar},
+		{Name: "focus_mode", Description: "toggle focus mode, hiding the title and the progress bar", Action: b.ToggleFocusMode},
+		{Name: "yank", Description: "copy the line at the top, or on the focus line, to the clipboard", Action: b.Yank},
+		{Name: "visual", Description: "select lines from the top, extended with j and k, to copy, annotate, look up or cite them", Action: b.StartSelection},
+		{Name: "look_up", Description: "look up the first word at the top, or on the focus line, in the dictionary", Action: b.LookUp},
+		{Name: "cite", Description: "add the paragraph at the top, or on the focus line, to the book's citations file", Action: b.Cite},
+		{Name: "scroll_right", Description: "scroll right, when lines aren't wrapped", Action: b.ScrollRight},
+		{Name: "scroll_left", Description: "scroll left, when lines aren't wrapped", Action: b.ScrollLeft},
+		{Name: "toggle_night", Description: "toggle night mode", Action: b.ToggleNight},
+		{Name: "footnotes", Description: "show the chapter's footnotes", Action: b.ShowFootnotes},
+		{Name: "stats", Description: "show reading statistics", Action: b.ShowStats},
+		{Name: "info", Description: "show the title screen", Action: b.ShowInfo},
+	}
+	if b.Library {
+		bindings = append(bindings, Binding{Name: "library", Description: "go back to the library", Action: func() {
+			b.backToLibrary = true
+			b.app.Stop()
+		}})
+	}
+
+	for i := range bindings {
+		bindings[i].Key = b.key(bindings[i].Name)
+	}
+
+	return bindings
+}
+
+// key returns the key bound to the action name, 0 if unbound.
+func (b Book) key(name string) rune {
+	if b.Keys == nil {
+		return DefaultKeys[name]
+	}
+
+	return b.Keys[name]
+}
+
+// runeHandler adapts fn to be used as a pending key handler, taking the
+// character typed after a prefix key.
+func runeHandler(fn func(rune)) func(*tcell.EventKey) {
+	return func(event *tcell.EventKey) {
+		fn(event.Rune())
+	}
+}
+
+type SpecialBinding struct {
+	Key         tcell.Key
+	Description string
+	Action      func()
+}
+
+// SpecialBindings lists the actions triggered by non-character keys.
+func (b *Book) SpecialBindings() []SpecialBinding {
+	return []SpecialBinding{
+		{tcell.KeyRight, "next chapter, previous one in right-to-left text", b.ChapterRight},
+		{tcell.KeyLeft, "previous chapter, next one in right-to-left text", b.ChapterLeft},
+		{tcell.KeyDown, "scroll down, or move down in the table of contents", b.LineDown},
+		{tcell.KeyUp, "scroll up, or move up in the table of contents", b.LineUp},
+		{tcell.KeyPgDn, "scroll down a page", b.PageDown},
+		{tcell.KeyPgUp, "scroll up a page", b.PageUp},
+		{tcell.KeyHome, "go to the start of the chapter", b.ScrollToTop},
+		{tcell.KeyEnd, "go to the end of the chapter", b.ScrollToBottom},
+		{tcell.KeyCtrlZ, "suspend to the shell", b.Suspend},
+		{tcell.KeyCtrlO, "go back to the position jumped from", b.HistoryBack},
+		{tcell.KeyTab, "go forward to the position gone back from (Ctrl-I)", b.HistoryForward},
+		{tcell.KeyEnter, "follow a link or open an image, followed by its number or enter for the first one on screen", b.StartFollowLink},
+	}
+}
+
+func keyName(r rune) string {
+	switch r {
+	case ' ':
+		return "space"
+	default:
+		return string(r)
+	}
+}
+
+func (b *Book) ShowHelp() {
+	bindings := b.Bindings()
+	special := b.SpecialBindings()
+
+	lines := make([]string, 0, len(bindings)+len(special))
+	for _, binding := range bindings {
+		if binding.Key == 0 {
+			continue
+		}
+		lines = append(lines, fmt.Sprintf("%-6s %s", keyName(binding.Key), binding.Description))
+	}
+	for _, binding := range special {
+		lines = append(lines, fmt.Sprintf("%-6s %s", tcell.KeyNames[binding.Key], binding.Description))
+	}
+
+	t := newOverlayText(b.Theme, "Keys", strings.Join(lines, "\n"))
+	t.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp, tcell.KeyDown, tcell.KeyPgUp, tcell.KeyPgDn, tcell.KeyHome, tcell.KeyEnd:
+			return event
+		}
+		b.HideOverlay()
+		return nil
+	})
+
+	b.ShowOverlay("help", t, b.Width, len(lines)+2)
+}
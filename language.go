@@ -0,0 +1,189 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+// DefaultLanguage is the language assumed when the book doesn't declare one
+// and its text doesn't tell.
+const DefaultLanguage = "en"
+
+// detectionWords is the number of words of the book's text looked at to
+// detect its language.
+const detectionWords = 2000
+
+// scriptLanguages are the languages assumed for the texts mostly written in
+// a script, the first matching one being used.
+var scriptLanguages = []struct {
+	script   *unicode.RangeTable
+	language string
+}{
+	{unicode.Arabic, "ar"},
+	{unicode.Hebrew, "he"},
+	{unicode.Cyrillic, "ru"},
+	{unicode.Greek, "el"},
+	{unicode.Hiragana, "ja"},
+	{unicode.Katakana, "ja"},
+	{unicode.Hangul, "ko"},
+	{unicode.Han, "zh"},
+}
+
+// stopWords are common short words of the languages written in the latin
+// script, counted to tell them apart.
+var stopWords = map[string][]string{
+	"en": {"the", "and", "of", "to", "in", "is", "was", "that", "he", "she", "it", "with", "for", "his", "her"},
+	"fr": {"le", "la", "les", "et", "de", "des", "un", "une", "est", "dans", "que", "qui", "pas", "il", "elle"},
+	"de": {"der", "die", "das", "und", "ist", "nicht", "ich", "er", "sie", "es", "ein", "eine", "mit", "zu", "den"},
+	"es": {"el", "la", "los", "las", "y", "de", "que", "en", "un", "una", "por", "con", "no", "se", "su"},
+	"it": {"il", "la", "di", "che", "e", "un", "una", "non", "per", "con", "del", "della", "lo", "gli", "è"},
+	"pt": {"o", "a", "os", "as", "e", "de", "que", "não", "um", "uma", "do", "da", "em", "com", "para"},
+	"nl": {"de", "het", "een", "en", "van", "is", "niet", "dat", "ik", "hij", "zij", "met", "op", "te", "voor"},
+}
+
+// bookLanguage returns the language of the book: the one from its metadata,
+// or else the one detected from the text of its first chapters, reporting
+// whether it was detected.
+func bookLanguage(r Reader, toc []TOCEntry) (string, bool) {
+	if language := metadataLanguage(r); language != "" {
+		return language, false
+	}
+
+	return textLanguage(r, toc), true
+}
+
+// metadataLanguage returns the language from the metadata of the book, an
+// empty string if it has none.
+func metadataLanguage(r Reader) string {
+	if languages, err := r.Metadata("language"); err == nil {
+		for _, language := range languages {
+			if language = strings.TrimSpace(language); language != "" {
+				return language
+			}
+		}
+	}
+
+	return ""
+}
+
+// textLanguage detects the language of the book from the text of its first
+// chapters, converting them if they aren't yet.
+func textLanguage(r Reader, toc []TOCEntry) string {
+	start := firstContentChapter(r, toc)
+	if start == -1 {
+		start = 0
+	}
+	var words []string
+	for i := start; i < len(toc) && len(words) < detectionWords; i++ {
+		text, err := r.ReadChapter(toc[i].URL)
+		if err != nil {
+			continue
+		}
+		words = append(words, strings.Fields(text)...)
+	}
+	if len(words) > detectionWords {
+		words = words[:detectionWords]
+	}
+
+	return detectLanguage(strings.Join(words, " "))
+}
+
+// DetectLanguage sets the language of the book from its metadata, or else
+// detects it from its text in the background so that opening the book isn't
+// held up converting chapters, the language being applied once known. It
+// must be called before Run.
+func (b *Book) DetectLanguage(r Reader, toc []TOCEntry) {
+	if language := metadataLanguage(r); language != "" {
+		b.setLanguage(language, false)
+		return
+	}
+
+	go func() {
+		language := textLanguage(r, toc)
+		b.app.QueueUpdateDraw(func() {
+			b.setLanguage(language, true)
+			if b.Hyphenate {
+				// the chapters shown meanwhile weren't hyphenated
+				b.RefreshChapters()
+			}
+		})
+	}()
+}
+
+// setLanguage sets the language of the book, aligning the chapters shown
+// according to its direction and loading its hyphenation dictionary if
+// hyphenation is on.
+func (b *Book) setLanguage(language string, detected bool) {
+	b.language, b.languageDetected = language, detected
+	b.rtlLanguage = isRTLLanguage(language)
+	for _, c := range b.Chapters {
+		if c.loaded {
+			b.applyDirection(c.Index())
+		}
+	}
+
+	if b.Hyphenate {
+		err := b.loadHyphenator()
+		if err != nil {
+			b.Hyphenate = false
+			b.Flash(err.Error())
+		}
+	}
+}
+
+// detectLanguage guesses the language of text, from the script most of its
+// letters are written in or else from the stop words it holds, defaulting to
+// DefaultLanguage.
+func detectLanguage(text string) string {
+	letters := 0
+	scripts := map[string]int{}
+	for _, r := range text {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+		letters++
+		for _, s := range scriptLanguages {
+			if unicode.Is(s.script, r) {
+				scripts[s.language]++
+				break
+			}
+		}
+	}
+	if letters == 0 {
+		return DefaultLanguage
+	}
+	if scripts["ja"] > 0 {
+		// Japanese mixes kana with Han characters
+		scripts["ja"] += scripts["zh"]
+		scripts["zh"] = 0
+	}
+	for _, s := range scriptLanguages {
+		if 2*scripts[s.language] > letters {
+			return s.language
+		}
+	}
+
+	counts := map[string]int{}
+	for _, word := range strings.Fields(strings.ToLower(text)) {
+		counts[trimWord(word)]++
+	}
+	language, best := DefaultLanguage, 0
+	for _, lang := range []string{"en", "fr", "de", "es", "it", "pt", "nl"} {
+		score := 0
+		for _, w := range stopWords[lang] {
+			score += counts[w]
+		}
+		if score > best {
+			language, best = lang, score
+		}
+	}
+
+	return language
+}
+
+// baseLanguage returns the language of a tag like en-US, lowercased.
+func baseLanguage(tag string) string {
+	tag = strings.Replace(tag, "_", "-", -1)
+
+	return strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+}
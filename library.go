@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+type LibraryEntry struct {
+	Fname string
+	Title string
+	Err   error
+
+	State    State
+	HasState bool
+}
+
+// loadState reads the saved state of the entry's book, an unreadable state
+// being treated as missing since it is only informative here.
+func (e *LibraryEntry) loadState() {
+	state, ok, err := LoadState(e.Fname)
+	e.State, e.HasState = state, ok && err == nil
+}
+
+// Description returns the secondary text of the entry in the library.
+func (e LibraryEntry) Description(now time.Time) string {
+	if !e.HasState || e.State.LastRead.IsZero() {
+		return e.Fname
+	}
+
+	sessions := fmt.Sprintf("%d sessions", e.State.Sessions)
+	if e.State.Sessions == 1 {
+		sessions = "1 session"
+	}
+
+	return fmt.Sprintf("%s - last read %s, %s", e.Fname, ago(e.State.LastRead, now), sessions)
+}
+
+// ago describes how long before now t is, in a human friendly way.
+func ago(t, now time.Time) string {
+	d := now.Sub(t)
+	plural := func(n int, unit string) string {
+		if n == 1 {
+			return fmt.Sprintf("1 %s ago", unit)
+		}
+		return fmt.Sprintf("%d %ss ago", n, unit)
+	}
+
+	switch {
+	case d < time.Minute:
+		return "just now"
+	case d < time.Hour:
+		return plural(int(d/time.Minute), "minute")
+	case d < 24*time.Hour:
+		return plural(int(d/time.Hour), "hour")
+	case d < 30*24*time.Hour:
+		return plural(int(d/(24*time.Hour)), "day")
+	default:
+		return "on " + t.Format("2006-01-02")
+	}
+}
+
+func loadLibrary(fnames []string) []LibraryEntry {
+	entries := make([]LibraryEntry, 0, len(fnames))
+	for _, fname := range fnames {
+		entry := LibraryEntry{
+			Fname: fname,
+			Title: fname,
+		}
+		entry.loadState()
+
+		ebook, err := openBook(fname)
+		if err != nil {
+			entry.Err = err
+			entries = append(entries, entry)
+			continue
+		}
+		if title := bookTitle(ebook); title != "" {
+			entry.Title = title
+		}
+		ebook.Close()
+
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func runLibrary(fnames []string, opts Options) error {
+	entries := loadLibrary(fnames)
+
+	current := 0
+	for {
+		picked, err := pickBook(entries, current)
+		if err != nil {
+			return err
+		}
+		if picked == -1 {
+			return nil
+		}
+		current = picked
+
+		back, err := readBook(entries[picked].Fname, opts, true)
+		entries[picked].loadState()
+		if err != nil {
+			entries[picked].Err = err
+			continue
+		}
+		if !back {
+			return nil
+		}
+	}
+}
+
+// pickBook shows the library and returns the index of the selected entry, or
+// -1 if the user quit.
+func pickBook(entries []LibraryEntry, current int) (int, error) {
+	app := tview.NewApplication()
+
+	l := tview.NewList()
+	applyListTheme(l, DefaultTheme)
+	l.SetBorder(true)
+	l.SetTitle("Library")
+
+	picked := -1
+	now := time.Now()
+	for i, entry := range entries {
+		if entry.Err != nil {
+			l.AddItem(
+				fmt.Sprintf("[gray]%s", tview.Escape(entry.Title)),
+				fmt.Sprintf("[gray]%s", tview.Escape(entry.Err.Error())),
+				0, nil,
+			)
+			continue
+		}
+
+		j := i
+		l.AddItem(tview.Escape(entry.Title), tview.Escape(entry.Description(now)), 0, func() {
+			picked = j
+			app.Stop()
+		})
+	}
+	l.SetCurrentItem(current)
+	l.SetDoneFunc(app.Stop)
+
+	g := tview.NewGrid()
+	g.SetColumns(-1, 80, -1)
+	g.SetBackgroundColor(DefaultTheme.Background)
+
+	g.Clear()
+	g.AddItem(l, 0, 1, 1, 1, 0, 0, true)
+
+	app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Rune() == 'q' {
+			app.Stop()
+			return nil
+		}
+		return event
+	})
+	app.SetRoot(g, true)
+
+	err := app.Run()
+
+	return picked, err
+}
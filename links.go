@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// StartFollowLink asks for the number of the link to follow in the current
+// chapter. On the table of contents, it opens the selected chapter instead.
+func (b *Book) StartFollowLink() {
+	if b.Current == b.TOC.Index() {
+		if idx := b.TOC.Selected(); idx != -1 {
+			b.TOC.cb(idx)
+		}
+		return
+	}
+
+	c := b.Chapters[b.Current]
+	if len(c.links) == 0 {
+		b.Flash("no links in this chapter")
+		return
+	}
+
+	b.promptNumber("follow link: ", b.FollowLink)
+}
+
+// FollowLink follows the link numbered s in the current chapter, starting
+// from 1. An empty s follows the first link on screen.
+func (b *Book) FollowLink(s string) {
+	c := b.Chapters[b.Current]
+
+	if s == "" {
+		top := c.GetOffset()
+		rows := c.sourceRows()
+		for _, link := range c.links {
+			// links refer to the lines of the text, not to the lines
+			// as shown
+			if link.Line < len(rows) && rows[link.Line] >= top {
+				b.openLink(link)
+				return
+			}
+		}
+		b.Flash("no link on screen")
+		return
+	}
+
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > len(c.links) {
+		b.Flash(fmt.Sprintf("no link %q, expected 1-%d", s, len(c.links)))
+		return
+	}
+
+	b.openLink(c.links[n-1])
+}
+
+// openLink opens the image a link points to in a viewer, or goes to its
+// target.
+func (b *Book) openLink(link Link) {
+	if link.Image {
+		b.OpenImage(link.Target)
+		return
+	}
+
+	b.OpenURL(link.Target)
+}
+
+// OpenURL goes to the chapter at the given URL, scrolling to its fragment if
+// any. Footnotes are shown in a popup instead.
+func (b *Book) OpenURL(u string) {
+	idx := b.chapterByURL(u)
+	if idx == -1 {
+		b.Flash(fmt.Sprintf("%s is not in the table of contents", chapterPath(u)))
+		return
+	}
+
+	id := urlFragment(u)
+	if note, ok := b.footnote(idx, id); ok {
+		b.showNotes("Footnote", note.Text)
+		return
+	}
+
+	b.recordJump()
+	if b.Current != idx {
+		b.GoToPage(idx)
+	}
+	b.Chapters[idx].ScrollToAnchor(id)
+}
+
+// chapterByURL returns the index of the chapter at the given URL, ignoring
+// fragments, or -1 if there is none.
+func (b Book) chapterByURL(u string) int {
+	u = chapterPath(u)
+	for i, c := range b.Chapters {
+		if chapterPath(c.URL()) == u {
+			return i
+		}
+	}
+
+	return -1
+}
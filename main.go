@@ -1,42 +1,343 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"flag"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gdamore/tcell"
-	"github.com/k3a/html2text"
 	"github.com/meskio/epubgo"
 	"github.com/rivo/tview"
 )
 
-var BackgroundColor = tcell.NewHexColor(0x002833)
-
 type Chapter struct {
+	// id names the chapter's page, it is the URL unless several chapters
+	// share it.
+	id    string
 	url   string
 	index int
-
-	g *tview.Grid
-	t *tview.TextView
+	title string
+	text  string
+
+	// links, anchors and footnotes are those of the chapter's content,
+	// anchor being the one to scroll to once the chapter is loaded.
+	links     []Link
+	anchors   map[string]int
+	footnotes []Footnote
+	anchor    string
+	// line is the line of the text to scroll to once the chapter is
+	// loaded, lineContext lines below the top, -1 for none.
+	line        int
+	lineContext int
+
+	words int
+	rtl   bool
+	// nonLinear is set for auxiliary chapters, skipped when moving through
+	// the chapters in order.
+	nonLinear bool
+	// code holds the lines of the text inside preformatted blocks, which
+	// are left as is by formatting.
+	code map[int]bool
+
+	book     Reader
+	loaded   bool
+	loading  bool
+	offset   int
+	fraction float64
+	// column is the horizontal scroll offset, when lines aren't wrapped.
+	column int
+
+	// width and height are the size the chapter was last drawn at, position
+	// the fraction scrolled at that size.
+	width    int
+	height   int
+	position float64
+
+	// columns is set when the chapter is shown in two columns, right being
+	// the second one. It shows rendered, the text of the first one, padded
+	// with padding blank lines.
+	columns  bool
+	rendered string
+	padding  int
+	// lineStarts holds the line of rendered each line of the text starts
+	// on, rendered for renderWidth columns, and wraps is set when the
+	// TextView wraps lines. See sourceRows.
+	lineStarts  []int
+	renderWidth int
+	wraps       bool
+
+	// selecting is set in visual mode, the wrapped lines from selectAnchor
+	// to selectCursor being selected.
+	selecting    bool
+	selectAnchor int
+	selectCursor int
+
+	g     *tview.Grid
+	t     *tview.TextView
+	right *tview.TextView
 }
 
 func (c Chapter) GetOffset() int {
+	if !c.loaded {
+		return c.offset
+	}
 	r, _ := c.t.GetScrollOffset()
 
 	return r
 }
 
 func (c *Chapter) SetOffset(r int) {
-	c.t.ScrollTo(r, 0)
+	c.fraction = -1
+	if !c.loaded {
+		c.offset = r
+		return
+	}
+	c.t.ScrollTo(r, c.column)
+}
+
+// ScrollToLine scrolls so that the line r is shown context lines below the
+// top, or as far down as possible near the start of the chapter.
+func (c *Chapter) ScrollToLine(r, context int) {
+	r -= context
+	if r < 0 {
+		r = 0
+	}
+	c.SetOffset(r)
+}
+
+// ScrollToSourceLine scrolls so that the line of the chapter's text, rather
+// than a line as shown, starts context lines below the top, once the chapter
+// is loaded.
+func (c *Chapter) ScrollToSourceLine(line, context int) {
+	if !c.loaded {
+		c.line = line
+		c.lineContext = context
+		return
+	}
+
+	c.ScrollToLine(c.sourceRow(line), context)
+}
+
+// scrollToPosition scrolls to a mark or a note at the line r as shown, or at
+// the line of the chapter's text when the chapter isn't rendered yet and the
+// line r may not match it anymore.
+func (c *Chapter) scrollToPosition(r, line, context int) {
+	if !c.loaded && line >= 0 {
+		c.ScrollToSourceLine(line, context)
+		return
+	}
+	c.ScrollToLine(r, context)
+}
+
+// sourceRows returns the line as shown each line of the chapter's text
+// starts on, once rendered and wrapped at the width of the TextView, or at
+// the width the text was rendered for before it is first drawn.
+func (c Chapter) sourceRows() []int {
+	width := c.renderWidth
+	if _, _, w, _ := c.t.GetInnerRect(); w > 0 {
+		width = w
+	}
+
+	rendered := strings.Split(c.t.GetText(true), "\n")
+	starts := make([]int, len(rendered)+1)
+	for i, line := range rendered {
+		n := 1
+		if c.wraps && width > 0 {
+			n = strings.Count(wrap(line, width), "\n") + 1
+		}
+		starts[i+1] = starts[i] + n
+	}
+
+	rows := make([]int, len(c.lineStarts))
+	for i, l := range c.lineStarts {
+		if l > len(rendered) {
+			l = len(rendered)
+		}
+		rows[i] = starts[l]
+	}
+
+	return rows
+}
+
+// sourceRow returns the line as shown the line of the chapter's text starts
+// on.
+func (c Chapter) sourceRow(line int) int {
+	rows := c.sourceRows()
+	switch {
+	case len(rows) == 0 || line < 0:
+		return 0
+	case line >= len(rows):
+		return rows[len(rows)-1]
+	}
+
+	return rows[line]
+}
+
+// sourceLine returns the line of the chapter's text shown on the line r.
+func (c Chapter) sourceLine(r int) int {
+	rows := c.sourceRows()
+	line := sort.Search(len(rows), func(i int) bool {
+		return rows[i] > r
+	})
+	if line > 0 {
+		line--
+	}
+
+	return line
+}
+
+// Fraction returns how far into the chapter the reader has scrolled, from 0 to
+// 1, or -1 if it can't be computed yet.
+func (c Chapter) Fraction() float64 {
+	if !c.loaded || c.fraction >= 0 {
+		return c.fraction
+	}
+
+	n, err := c.t.NLines()
+	if err != nil || n == 0 {
+		return -1
+	}
+
+	return float64(c.GetOffset()) / float64(n)
+}
+
+// SetFraction scrolls to the given fraction of the chapter. The wrapped line
+// count is only known once the chapter has been drawn, so the scroll happens
+// on the next draw.
+func (c *Chapter) SetFraction(f float64) {
+	c.fraction = f
+}
+
+// draw is called before the chapter is drawn at the given size. The scroll
+// position can only be applied once the text is wrapped, so it is queued
+// after the draw. When the size changed, the position recorded by track is
+// restored, since the wrapped line offset no longer points to the same text.
+func (c *Chapter) draw(queueFn func(func()), width, height int) {
+	resized := c.width != 0 && (width != c.width || height != c.height)
+	c.width, c.height = width, height
+	if resized && c.loaded && c.fraction < 0 && c.position >= 0 {
+		c.fraction = c.position
+	}
+
+	if !c.loaded || c.fraction < 0 {
+		return
+	}
+
+	queueFn(func() {
+		if c.fraction < 0 {
+			return
+		}
+		n, err := c.t.NLines()
+		if err != nil || n == 0 {
+			return
+		}
+
+		c.t.ScrollTo(int(c.fraction*float64(n)), c.column)
+		c.fraction = -1
+		c.track()
+	})
+}
+
+// track records the scroll position of the chapter as drawn, so that it can
+// be restored after a resize, and clamps the scroll offset so that it doesn't
+// go past the end of the text. It reports whether it scrolled.
+func (c *Chapter) track() bool {
+	if !c.loaded || c.fraction >= 0 {
+		return false
+	}
+	n, err := c.t.NLines()
+	if err != nil || n == 0 {
+		return false
+	}
+
+	scrolled := false
+	r := c.GetOffset()
+	if last := n - c.visibleLines(); last >= 0 && r > last {
+		c.t.ScrollTo(last, c.column)
+		r = last
+		scrolled = true
+	}
+	c.position = float64(r) / float64(n)
+
+	return scrolled
+}
+
+// lineText returns the first non-blank line of the chapter at or after the
+// wrapped line r, as drawn at its current width.
+func (c Chapter) lineText(r int) string {
+	lines := c.wrappedLines()
+	for ; r >= 0 && r < len(lines); r++ {
+		if line := strings.TrimSpace(lines[r]); line != "" {
+			return line
+		}
+	}
+
+	return ""
+}
+
+// wrappedLines returns the lines of the chapter as drawn at its current
+// width, nil if it isn't drawn yet.
+func (c Chapter) wrappedLines() []string {
+	if !c.loaded {
+		return nil
+	}
+	_, _, width, _ := c.t.GetInnerRect()
+	if width <= 0 {
+		return nil
+	}
+
+	return strings.Split(wrap(c.t.GetText(true), width), "\n")
+}
+
+// ScrollToAnchor scrolls to the element with the given id once the chapter
+// is loaded, or to the top if there is no such element. Anchors refer to the
+// lines of the text, not to the lines as shown.
+func (c *Chapter) ScrollToAnchor(id string) {
+	if !c.loaded && id != "" {
+		c.anchor = id
+		return
+	}
+
+	line, ok := c.anchors[id]
+	if !ok {
+		c.SetOffset(0)
+		return
+	}
+	c.SetOffset(c.sourceRow(line))
+}
+
+func (c *Chapter) SetTheme(theme Theme) {
+	c.g.SetBackgroundColor(theme.Background)
+	for _, t := range []*tview.TextView{c.t, c.right} {
+		t.SetBackgroundColor(theme.Background)
+		t.SetTextColor(theme.Foreground)
+	}
 }
 
 func (c *Chapter) SetWidth(w int) {
+	if c.columns {
+		c.g.SetColumns(-1, w, ColumnGap, w, -1)
+		return
+	}
 	c.g.SetColumns(-1, w, -1)
 }
 
+func (c Chapter) ID() string {
+	return c.id
+}
+
 func (c Chapter) URL() string {
 	return c.url
 }
@@ -48,8 +349,22 @@ func (c Chapter) Index() int {
 type TOC struct {
 	url string
 
-	g *tview.Grid
-	l *tview.List
+	entries   []TOCEntry
+	cb        func(int)
+	secondary func(int) string
+
+	// indices maps the list items to their chapter index, which differ when
+	// a filter is applied.
+	indices []int
+	filter  string
+
+	g     *tview.Grid
+	l     *tview.List
+	input *tview.InputField
+}
+
+func (t TOC) ID() string {
+	return t.url
 }
 
 func (t TOC) URL() string {
@@ -64,13 +379,37 @@ func (t *TOC) SetWidth(w int) {
 	t.g.SetColumns(-1, w, -1)
 }
 
+func (t *TOC) SetTheme(theme Theme) {
+	t.g.SetBackgroundColor(theme.Background)
+	applyListTheme(t.l, theme)
+	applyInputTheme(t.input, theme)
+}
+
 func (t *TOC) SetSelected(idx int) {
-	t.l.SetCurrentItem(idx)
+	for i, j := range t.indices {
+		if j == idx {
+			t.l.SetCurrentItem(i)
+			return
+		}
+	}
+}
+
+// Selected returns the chapter index of the selected item, or -1 if the list
+// is empty.
+func (t TOC) Selected() int {
+	i := t.l.GetCurrentItem()
+	if i < 0 || i >= len(t.indices) {
+		return -1
+	}
+
+	return t.indices[i]
 }
 
 type Page interface {
+	ID() string
 	Index() int
 	SetWidth(int)
+	SetTheme(Theme)
 	URL() string
 }
 
@@ -78,100 +417,333 @@ type Book struct {
 	app    *tview.Application
 	tPages *tview.Pages
 
+	base       *tview.Grid
+	title      *tview.TextView
+	status     *tview.TextView
+	statusLine string
+	// progress shows the position as a gauge above the status bar, or the
+	// chapters loaded so far while preloading is set.
+	progress     *tview.TextView
+	progressLine string
+	preloading   bool
+
+	Theme Theme
+	// Night dims Theme with warmer colors.
+	Night bool
+
 	Title    string
 	TOC      *TOC
 	Chapters []*Chapter
 	Pages    []Page
 
+	// LineCounts holds the number of wrapped lines in each chapter, zero for
+	// chapters that haven't been rendered yet.
+	LineCounts []int
+
 	pagesMap map[string]Page
 
-	MarkChapter int
-	MarkLine    int
+	Marks map[rune]Mark
+	// Notes holds the notes attached to the book, in its order.
+	Notes []Note
+	// Furthest holds the furthest fraction scrolled in each chapter that was
+	// opened, which unlike the current position never goes back. It is 1
+	// once the end of the chapter was shown.
+	Furthest map[int]float64
 
 	Width       int
 	Current     int
 	menuContext int
+
+	// FocusLine marks the line at FocusLinePosition of the text's height,
+	// DefaultFocusLinePosition when zero, for the eyes to follow while
+	// scrolling.
+	FocusLine         bool
+	FocusLinePosition float64
+	// Scrollbar shows where the text shown, the marks and the notes are in
+	// the chapter, beside the text.
+	Scrollbar bool
+	// ConfirmQuit asks for a confirmation before quitting. See Quit.
+	ConfirmQuit bool
+	// ScrollOff is the number of lines shown above the line jumped to, when
+	// jumping to a mark or a search match.
+	ScrollOff int
+	// JumpDistance is the number of lines scrolled by JumpScroll, the height
+	// of the visible text when zero.
+	JumpDistance int
+	// ChapterSkip is the number of chapters skipped by SkipChapters'
+	// bindings, DefaultChapterSkip when zero.
+	ChapterSkip int
+
+	Justify bool
+	// Hyphenate hyphenates the words that don't fit at the end of lines,
+	// using hyphenator, loaded from HyphenationPatterns or the dictionary
+	// for the book's language.
+	Hyphenate           bool
+	HyphenationPatterns string
+	hyphenator          *Hyphenator
+	// language is the book's language tag, from its metadata or detected
+	// from its text when languageDetected.
+	language         string
+	languageDetected bool
+	// LineNumbers prefixes each line of the text with its number.
+	LineNumbers bool
+	// Spacing is the number of blank lines added between paragraphs, and
+	// Margin the number of blank lines above and below the text.
+	Spacing int
+	Margin  int
+	// Zoom is the zoom level, narrowing the text and adding to Margin as it
+	// increases. See SetZoom.
+	Zoom int
+	// ParagraphIndent is the number of spaces the first line of paragraphs
+	// is indented by, as in print.
+	ParagraphIndent int
+
+	// Direction is "rtl" or "ltr" when set with ToggleRTL, empty to use the
+	// direction detected from the book's language or the chapter markup.
+	Direction   string
+	rtlLanguage bool
+	// Wrap is "on" or "off" when set with ToggleWrap, empty for chapters to
+	// be wrapped unless they are mostly preformatted text.
+	Wrap string
+	// Columns is set with ToggleColumns for chapters to be shown in two
+	// columns, which they are when columns is set, the terminal being wide
+	// enough.
+	Columns bool
+	columns bool
+	// FocusMode hides the title and the progress bar, leaving their rows to
+	// the text.
+	FocusMode bool
+
+	// WPM is the reading speed used for reading time estimates, DefaultWPM
+	// when zero.
+	WPM int
+	// Dictionary is the command words are looked up with, followed by its
+	// arguments, dict or sdcv being used when empty.
+	Dictionary string
+	// CitationStyle is the style citations are recorded in, CitationPlain
+	// or CitationMarkdown.
+	CitationStyle string
+	// WordCounts caches the number of words in each chapter, nil until
+	// counted, and WordsPerPage is used to estimate the number of pages,
+	// DefaultWordsPerPage when zero.
+	WordCounts   *WordCounts
+	WordsPerPage int
+	// ProgressMode is ProgressChapter for the progress bar to show the
+	// position in the current chapter rather than in the whole book.
+	ProgressMode string
+	// SmoothScroll animates scrolling by pages over ScrollDuration, scrolling
+	// being the animation in progress.
+	SmoothScroll   bool
+	ScrollDuration time.Duration
+	scrolling      *scrollAnimation
+	// activity receives each key press when the reader quits after being
+	// idle, see quitWhenIdle.
+	activity chan struct{}
+	// Mouse enables scrolling with the wheel and clicking the table of
+	// contents and the progress bar.
+	Mouse bool
+	// mouse is the screen handling the mouse, nil when it is disabled.
+	mouse *mouseScreen
+	// mouseButtons are the buttons pressed at the last mouse event.
+	mouseButtons tcell.ButtonMask
+
+	fname  string
+	ebook  Reader
+	search *Search
+	// searches counts the searches started, so that only the results of
+	// the last one are shown.
+	searches int
+	// tempFiles holds the images extracted to be shown in a viewer, removed
+	// when the book is closed.
+	tempFiles []string
+
+	// Keys maps action names to their key, DefaultKeys being used when nil.
+	Keys map[string]rune
+
+	Library       bool
+	backToLibrary bool
+
+	// Sessions is the number of times the book was opened, this time
+	// included.
+	Sessions int
+	// finishedBefore is the number of chapters finished before this
+	// session, for the reading activity.
+	finishedBefore int
+
+	// ReadingTime is the time spent reading the book in previous sessions.
+	ReadingTime  time.Duration
+	sessionStart time.Time
+	pausedAt     time.Time
+	paused       time.Duration
+
+	// history holds the positions jumped from, historyAt being the one
+	// gone back to, or len(history) when none was.
+	history   []historyEntry
+	historyAt int
+	// ChapterHistory records moving to the next or previous chapter in
+	// the navigation history too.
+	ChapterHistory bool
+
+	overlay     string
+	peeking     *peek
+	pending     func(event *tcell.EventKey)
+	message     string
+	numberInput string
 }
 
 func (b *Book) Initialize() {
 	b.app = tview.NewApplication()
 	b.tPages = tview.NewPages()
-	b.tPages.SetBackgroundColor(BackgroundColor)
+	b.tPages.SetBackgroundColor(b.Theme.Background)
+
+	b.base = tview.NewGrid()
+	b.base.SetColumns(-1)
+	b.base.SetBackgroundColor(b.Theme.Background)
+
+	b.title = tview.NewTextView()
+	b.title.SetBackgroundColor(b.Theme.Background)
+	b.title.SetTextColor(b.Theme.Foreground)
+	b.title.SetText(b.Title)
+	b.title.SetTextAlign(tview.AlignCenter)
+
+	b.status = tview.NewTextView()
+	b.status.SetBackgroundColor(b.Theme.Background)
+	b.status.SetTextColor(b.Theme.Foreground)
+	b.status.SetTextAlign(tview.AlignCenter)
+
+	b.progress = tview.NewTextView()
+	b.progress.SetBackgroundColor(b.Theme.Background)
+	b.progress.SetTextColor(b.Theme.Foreground)
+	b.progress.SetTextAlign(tview.AlignCenter)
+
+	b.layoutBase()
 }
 
 func (b *Book) Run() error {
+	b.sessionStart = time.Now()
+
+	// the status depends on what was just drawn (scroll offset, wrapped line
+	// count), it is refreshed after each draw, which redraws only if it
+	// changed.
+	b.app.SetAfterDrawFunc(func(screen tcell.Screen) {
+		b.drawFocusLine(screen)
+		b.drawSelection(screen)
+		b.app.QueueUpdate(b.afterDraw)
+	})
 
-	base := tview.NewGrid()
-	base.SetColumns(-1)
-	base.SetRows(2, -1)
-	base.SetBackgroundColor(BackgroundColor)
-	base.Clear()
-
-	title := tview.NewTextView()
-	title.SetBackgroundColor(BackgroundColor)
-	title.SetTextColor(tcell.ColorDefault)
-	title.SetText(b.Title)
-	title.SetTextAlign(tview.AlignCenter)
-
-	base.AddItem(title, 0, 0, 1, 1, 0, 0, false)
-	base.AddItem(b.tPages, 1, 0, 1, 1, 0, 0, true)
-
-	b.app.SetRoot(base, true)
-	b.app.SetFocus(base)
-
-	actions := map[rune]func(){
-		'q': b.app.Stop,
-		'l': b.NextChapter,
-		'h': b.PreviousChapter,
-		'/': b.ToggleMenu,
-		'j': b.MenuDown,
-		'k': b.MenuUp,
-		'm': func() {
-			if b.Current == b.TOC.Index() {
-				return
-			}
+	b.app.SetRoot(b.base, true)
+	b.app.SetFocus(b.base)
+	if b.Mouse {
+		screen, err := newMouseScreen(func(event *tcell.EventMouse) {
+			b.app.QueueUpdateDraw(func() {
+				b.handleMouse(event)
+			})
+		})
+		if err != nil {
+			return err
+		}
+		b.mouse = screen
+		b.app.SetScreen(screen)
+	}
 
-			b.MarkChapter = b.Current
-			b.MarkLine = b.Chapters[b.Current].GetOffset()
-		},
-		'\'': func() {
-			if b.MarkChapter == -1 || b.MarkLine == -1 {
-				return
-			}
+	actions := map[rune]func(){}
+	for _, binding := range b.Bindings() {
+		if binding.Key == 0 {
+			continue
+		}
+		actions[binding.Key] = binding.Action
+	}
+	special := map[tcell.Key]func(){}
+	for _, binding := range b.SpecialBindings() {
+		special[binding.Key] = binding.Action
+	}
 
-			if b.Chapters[b.MarkChapter].GetOffset() != b.MarkLine {
-				b.Chapters[b.MarkChapter].SetOffset(b.MarkLine)
+	b.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if b.activity != nil {
+			select {
+			case b.activity <- struct{}{}:
+			default:
 			}
-			if b.Current != b.MarkChapter {
-				b.GoToPage(b.MarkChapter)
+		}
+		if b.overlay != "" {
+			return event
+		}
+		b.finishScrolling()
+		if b.pending != nil {
+			pending := b.pending
+			b.pending = nil
+			pending(event)
+			return nil
+		}
+		if b.Current != b.TOC.Index() && b.Chapters[b.Current].selecting {
+			b.handleSelection(event)
+			return nil
+		}
+
+		if event.Key() != tcell.KeyRune {
+			action, ok := special[event.Key()]
+			if !ok {
+				return event
 			}
-		},
-		' ': b.JumpScroll,
-		'+': func() { b.SetWidth(b.Width + 5) },
-		'-': func() { b.SetWidth(b.Width + -5) },
-		'=': func() { b.SetWidth(80) },
-	}
+			action()
+			return nil
+		}
 
-	b.app.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
 		action, ok := actions[event.Rune()]
 		if !ok {
 			return event
 		}
 		action()
+		if b.pending != nil {
+			// the key is a prefix, don't let the focused primitive
+			// handle it too
+			return nil
+		}
 		return event
 	})
 
 	return b.app.Run()
 }
 
-func (b Book) Page(u string) (Page, error) {
+func (b *Book) afterDraw() {
+	if _, _, available, _ := b.base.GetRect(); available >= MinWidth && b.Width > available {
+		// the terminal was narrowed
+		b.SetWidth(available)
+	}
+	b.layoutColumns()
+	if b.Current != b.TOC.Index() {
+		c := b.Chapters[b.Current]
+		if c.track() || c.syncColumns() {
+			b.app.Draw()
+		}
+		b.recordFurthest(c)
+	}
+	b.updateStatus()
+}
+
+// recordFurthest raises the furthest position of the chapter to the one last
+// tracked.
+func (b *Book) recordFurthest(c *Chapter) {
+	if !c.loaded || c.position < 0 {
+		return
+	}
+	position := c.position
+	if n, err := c.t.NLines(); err == nil && c.GetOffset()+c.visibleLines() >= n {
+		position = 1
+	}
+	if f, ok := b.Furthest[c.Index()]; !ok || position > f {
+		b.Furthest[c.Index()] = position
+	}
+}
+
+func (b Book) Page(id string) (Page, error) {
 	if b.pagesMap == nil {
-		return nil, fmt.Errorf("page %q not found: no pages added", u)
+		return nil, fmt.Errorf("page %q not found: no pages added", id)
 	}
 
-	p, ok := b.pagesMap[u]
+	p, ok := b.pagesMap[id]
 	if !ok {
-		return nil, fmt.Errorf("page %q not found", u)
+		return nil, fmt.Errorf("page %q not found", id)
 	}
 
 	return p, nil
@@ -179,11 +751,12 @@ func (b Book) Page(u string) (Page, error) {
 
 func (b *Book) AddChapter(c *Chapter) {
 	b.Chapters = append(b.Chapters, c)
+	b.LineCounts = append(b.LineCounts, 0)
 	b.Pages = append(b.Pages, c)
 	if b.pagesMap == nil {
 		b.pagesMap = map[string]Page{}
 	}
-	b.pagesMap[c.URL()] = c
+	b.pagesMap[c.ID()] = c
 }
 
 func (b *Book) SetTOC(t *TOC) {
@@ -192,71 +765,232 @@ func (b *Book) SetTOC(t *TOC) {
 	if b.pagesMap == nil {
 		b.pagesMap = map[string]Page{}
 	}
-	b.pagesMap[t.URL()] = t
+	b.pagesMap[t.ID()] = t
 }
 
+// SetWidth sets the width of the text, clamped between MinWidth and the width
+// of the terminal once it is known.
 func (b *Book) SetWidth(w int) {
+	if w < MinWidth {
+		w = MinWidth
+		b.Flash(fmt.Sprintf("width can't be less than %d", MinWidth))
+	}
+	if _, _, available, _ := b.base.GetRect(); available >= MinWidth && w > available {
+		w = available
+		b.Flash(fmt.Sprintf("width limited to the terminal's %d columns", available))
+	}
+	if w == b.Width {
+		return
+	}
+
 	b.Width = w
 	for _, p := range b.Pages {
 		p.SetWidth(w)
 	}
+	if b.Justify || b.Hyphenate {
+		b.RefreshChapters()
+	}
 }
 
 func (b *Book) GoToPage(idx int) {
-	u := b.IndexToURL(idx)
+	id := b.IndexToID(idx)
 	b.Current = idx
 	if idx != b.TOC.Index() {
-		b.TOC.SetSelected(idx)
+		// leaving the table of contents ends any peek. Its selection
+		// is left where it was browsed to, rather than following the
+		// current chapter.
+		b.peeking = nil
+		b.LoadChapter(b.Chapters[idx])
+	} else {
+		// the progress of the chapters changed while reading
+		for i := range b.Chapters {
+			b.TOC.Refresh(i)
+		}
 	}
-	b.tPages.SwitchToPage(u)
+	b.tPages.SwitchToPage(id)
 }
 
-func (b Book) IndexToURL(idx int) string {
+// OpenChapter goes to the chapter idx, scrolling to the anchor its URL points
+// to if any.
+func (b *Book) OpenChapter(idx int) {
+	b.GoToPage(idx)
+
+	c := b.Chapters[idx]
+	if id := urlFragment(c.URL()); id != "" {
+		c.ScrollToAnchor(id)
+	}
+}
+
+// LoadChapter reads and converts the chapter's text in the background the
+// first time it is needed, the "Loading…" placeholder being shown meanwhile.
+func (b *Book) LoadChapter(c *Chapter) {
+	if c.loaded || c.loading {
+		return
+	}
+	c.loading = true
+
+	go b.readChapter(c)
+}
+
+// Preload reads and converts the chapters that aren't loaded yet in the
+// background, with the given number of workers, starting from the current
+// one. Chapters then show at once when opened, and reading estimates cover
+// the whole book. It must be called from the UI goroutine, or before Run.
+func (b *Book) Preload(workers int) {
+	start := b.Current
+	if start < 0 {
+		start = 0
+	}
+
+	var chapters []*Chapter
+	for i := range b.Chapters {
+		c := b.Chapters[(start+i)%len(b.Chapters)]
+		if c.loaded || c.loading {
+			continue
+		}
+		c.loading = true
+		chapters = append(chapters, c)
+	}
+
+	b.preloading = len(chapters) > 0
+
+	queue := make(chan *Chapter)
+	for i := 0; i < workers; i++ {
+		go func() {
+			for c := range queue {
+				b.readChapter(c)
+			}
+		}()
+	}
+	go func() {
+		for _, c := range chapters {
+			queue <- c
+		}
+		close(queue)
+	}()
+}
+
+// readChapter reads and converts the chapter's text, then shows it from the
+// UI goroutine.
+func (b *Book) readChapter(c *Chapter) {
+	content, err := c.book.ReadContent(c.URL())
+	if err != nil {
+		content = Content{Text: fmt.Sprintf("failed to load chapter: %s", err)}
+	}
+
+	b.app.QueueUpdateDraw(func() {
+		b.setContent(c, content)
+	})
+}
+
+// setContent shows the content read for the chapter, scrolling to the
+// position, anchor or line requested while it was loading.
+func (b *Book) setContent(c *Chapter, content Content) {
+	c.text = content.Text
+	c.links = content.Links
+	c.anchors = content.Anchors
+	c.footnotes = content.Footnotes
+	c.words = countWords(stripMarkup(content.Text))
+	c.rtl = content.RTL
+	c.code = map[int]bool{}
+	for _, line := range content.Preformatted {
+		c.code[line] = true
+	}
+	b.applyDirection(c.Index())
+	b.applyWrap(c.Index())
+	c.loaded = true
+	c.loading = false
+	b.RefreshChapter(c)
+	b.TOC.Refresh(c.Index())
+	c.t.ScrollTo(c.offset, c.column)
+	if c.anchor != "" {
+		c.ScrollToAnchor(c.anchor)
+		c.anchor = ""
+	}
+	if c.line >= 0 {
+		c.ScrollToSourceLine(c.line, c.lineContext)
+		c.line = -1
+	}
+}
+
+func (b Book) IndexToID(idx int) string {
 	if idx == -1 {
-		return b.TOC.URL()
+		return b.TOC.ID()
 	}
 
-	return b.Chapters[idx].URL()
+	return b.Chapters[idx].ID()
+}
+
+// pageID returns a page name for the chapter at u, unique even when several
+// entries of the table of contents share the URL.
+func (b Book) pageID(u string) string {
+	id := u
+	for n := 2; ; n++ {
+		if _, ok := b.pagesMap[id]; !ok {
+			return id
+		}
+		id = fmt.Sprintf("%s~%d", u, n)
+	}
 }
 
 func (b *Book) GenerateTOC(toc []TOCEntry, initialPage int) {
-	tocP, tocL := renderTOC(b.Width, toc, func(i int) {
-		b.GoToPage(i)
-	})
+	cb := func(i int) {
+		b.OpenChapter(i)
+	}
+	tocP, tocL := renderTOC(b.Theme, b.Width, toc, cb)
 	if b.Current != -1 {
 		tocL.SetCurrentItem(b.Current)
 	}
 
+	indices := make([]int, len(toc))
+	for i := range toc {
+		indices[i] = i
+	}
+
 	b.SetTOC(&TOC{
-		url: "TOC",
-		g:   tocP,
-		l:   tocL,
+		url:     "TOC",
+		entries: toc,
+		cb:      cb,
+		secondary: func(i int) string {
+			return b.tocSecondary(i)
+		},
+		indices: indices,
+		g:       tocP,
+		l:       tocL,
+		input:   b.newTOCFilterInput(),
 	})
 
-	b.tPages.AddPage(b.TOC.URL(), b.TOC.g, true, initialPage == b.TOC.Index())
+	b.tPages.AddPage(b.TOC.ID(), b.TOC.g, true, initialPage == b.TOC.Index())
 }
 
-func (b *Book) GenerateChapter(book *EBook, i int, u string, initialPage, initialOffset int, progress string, queueFn func(func())) error {
-	p, t, err := renderChapter(b.Width, book, u, progress, queueFn)
-	if err != nil {
-		return err
-	}
+func (b *Book) GenerateChapter(book Reader, i int, u string, initialPage, initialOffset int, title string, queueFn func(func())) {
+	p, t := renderChapter(b.Theme, b.Width, b.margin(), "Loading…")
 
 	page := &Chapter{
-		url:   u,
-		index: i,
-		g:     p,
-		t:     t,
+		id:       b.pageID(u),
+		url:      u,
+		index:    i,
+		title:    title,
+		book:     book,
+		offset:   initialOffset,
+		line:     -1,
+		fraction: -1,
+		position: -1,
+		padding:  -1,
+		g:        p,
+		t:        t,
+		right:    newChapterText(b.Theme, ""),
 	}
 
-	if initialOffset > 0 {
-		t.ScrollTo(initialOffset, 0)
-	}
-	b.tPages.AddPage(page.URL(), page.g, true, initialPage == page.Index())
+	t.SetDrawFunc(func(screen tcell.Screen, x, y, width, height int) (int, int, int, int) {
+		page.draw(queueFn, width, height)
+		b.drawScrollbar(screen, page, x, y, width, height)
+		return x, y, width, height
+	})
 
-	b.AddChapter(page)
+	b.tPages.AddPage(page.ID(), page.g, true, initialPage == page.Index())
 
-	return nil
+	b.AddChapter(page)
 }
 
 func (b Book) State() State {
@@ -266,9 +1000,27 @@ func (b Book) State() State {
 	}
 
 	state := State{
-		Page:    current,
-		Offsets: map[int]int{},
-		Width:   b.Width,
+		Version:   stateVersion,
+		Page:      current,
+		Offsets:   map[int]int{},
+		Fractions: map[int]float64{},
+		Width:     b.Width,
+		Theme:     b.Theme.Name,
+		Night:     b.Night,
+		Spacing:   b.Spacing,
+		Direction: b.Direction,
+		Wrap:      b.Wrap,
+		Columns:   b.Columns,
+		FocusMode: b.FocusMode,
+		Zoom:      b.Zoom,
+		Words:     b.WordCounts,
+		Marks:     b.Marks,
+		Notes:     b.Notes,
+		Furthest:  b.Furthest,
+		Sessions:  b.Sessions,
+
+		TOCSelected:         b.TOC.Selected(),
+		TotalReadingSeconds: int64(b.TotalReadingTime() / time.Second),
 	}
 
 	for _, c := range b.Chapters {
@@ -278,6 +1030,9 @@ func (b Book) State() State {
 		}
 
 		state.Offsets[c.Index()] = r
+		if f := c.Fraction(); f >= 0 {
+			state.Fractions[c.Index()] = f
+		}
 	}
 
 	return state
@@ -286,200 +1041,987 @@ func (b Book) State() State {
 func (b *Book) LoadState(state State) {
 	b.Current = state.Page
 	b.menuContext = state.Page
+	b.TOC.SetSelected(state.TOCSelected)
 	b.SetWidth(state.Width)
+	b.Night = state.Night
+	b.Direction = state.Direction
+	b.Wrap = state.Wrap
+	b.Columns = state.Columns
+	if state.Zoom >= MinZoom && state.Zoom <= MaxZoom && state.Zoom != b.Zoom {
+		// the width is restored on its own, as it may have been changed
+		// since zooming
+		b.Zoom = state.Zoom
+		b.layoutChapters()
+	}
+	if state.FocusMode != b.FocusMode {
+		b.FocusMode = state.FocusMode
+		b.layoutBase()
+	}
+	b.WordCounts = state.Words
+	if state.Spacing >= 0 && state.Spacing <= MaxSpacing {
+		b.Spacing = state.Spacing
+	}
+	if theme, ok := ThemeByName(state.Theme); ok {
+		b.SetTheme(theme)
+	} else {
+		b.SetTheme(DefaultTheme)
+	}
+	if state.Marks != nil {
+		b.Marks = state.Marks
+	}
+	b.Notes = state.Notes
+	if state.Furthest != nil {
+		b.Furthest = state.Furthest
+	}
+	for idx, f := range state.Fractions {
+		if idx < 0 || idx >= len(b.Chapters) {
+			continue
+		}
+		b.Chapters[idx].SetFraction(f)
+	}
 
 	b.GoToPage(state.Page)
 }
 
+// BookProgress returns the fraction of the whole book read when at the given
+// line of the given chapter. Chapters that haven't been rendered yet are
+// assumed to be as long as the average rendered one, which falls back to the
+// chapter ordinal when nothing was rendered.
+func (b Book) BookProgress(idx, line int) float64 {
+	known, sum := 0, 0
+	for _, n := range b.LineCounts {
+		if n == 0 {
+			continue
+		}
+		known++
+		sum += n
+	}
+
+	avg := 1
+	if known > 0 {
+		avg = sum / known
+	}
+	count := func(i int) int {
+		if b.LineCounts[i] == 0 {
+			return avg
+		}
+		return b.LineCounts[i]
+	}
+
+	total, read := 0, 0
+	for i := range b.LineCounts {
+		n := count(i)
+		total += n
+		if i < idx {
+			read += n
+		}
+	}
+	if b.LineCounts[idx] > 0 {
+		read += line
+	}
+	if total == 0 {
+		return 0
+	}
+
+	return float64(read) / float64(total)
+}
+
+// NextChapter goes to the next chapter in the reading order, skipping the
+// non-linear ones.
 func (b *Book) NextChapter() {
-	if b.Current+1 >= len(b.Chapters) {
+	idx := b.linearChapter(b.Current+1, 1)
+	if idx == -1 {
+		return
+	}
+
+	if b.ChapterHistory {
+		b.recordJump()
+	}
+	b.GoToPage(idx)
+}
+
+// PreviousChapter goes to the previous chapter in the reading order,
+// skipping the non-linear ones, or to the table of contents from the first
+// one.
+func (b *Book) PreviousChapter() {
+	if b.Current == b.TOC.Index() {
+		return
+	}
+
+	if b.ChapterHistory {
+		b.recordJump()
+	}
+	b.GoToPage(b.linearChapter(b.Current-1, -1))
+}
+
+// linearChapter returns the first chapter from idx in the direction of step
+// that is part of the reading order, or -1 if there is none.
+func (b Book) linearChapter(idx, step int) int {
+	for ; idx >= 0 && idx < len(b.Chapters); idx += step {
+		if !b.Chapters[idx].nonLinear {
+			return idx
+		}
+	}
+
+	return -1
+}
+
+// SkipChapters moves n chapters forward, or backward when n is negative,
+// stopping at the first or last chapter. Landing on a non-linear chapter
+// moves on to the next one in the reading order.
+func (b *Book) SkipChapters(n int) {
+	idx := b.Current + n
+	if idx >= len(b.Chapters) {
+		idx = len(b.Chapters) - 1
+	}
+	if idx < 0 {
+		idx = 0
+	}
+	step := 1
+	if n < 0 {
+		step = -1
+	}
+	if linear := b.linearChapter(idx, step); linear != -1 {
+		idx = linear
+	} else if linear := b.linearChapter(idx, -step); linear != -1 {
+		idx = linear
+	}
+	if idx == b.Current {
+		return
+	}
+
+	b.GoToPage(idx)
+}
+
+// NextUnreadChapter goes to the next chapter whose end wasn't reached yet,
+// at the position it was left at, wrapping around after the last chapter.
+func (b *Book) NextUnreadChapter() {
+	from := b.Current
+	if from == b.TOC.Index() {
+		from = b.menuContext
+	}
+
+	for i := 1; i <= len(b.Chapters); i++ {
+		idx := (from + i) % len(b.Chapters)
+		if idx == from {
+			break
+		}
+		if f, ok := b.Furthest[idx]; ok && f >= 1 || b.Chapters[idx].nonLinear {
+			continue
+		}
+
+		if idx < from {
+			b.Flash("wrapped around to the start of the book")
+		}
+		b.GoToPage(idx)
+		return
+	}
+
+	b.Flash("no other unread chapter")
+}
+
+// chapterSkip returns the number of chapters skipped at once.
+func (b Book) chapterSkip() int {
+	if b.ChapterSkip <= 0 {
+		return DefaultChapterSkip
+	}
+
+	return b.ChapterSkip
+}
+
+func (b *Book) ToggleMenu() {
+	if b.Current == b.TOC.Index() {
+		b.GoToPage(b.menuContext)
+		return
+	}
+	b.menuContext = b.Current
+	b.GoToPage(b.TOC.Index())
+}
+
+func (b *Book) MenuDown() {
+	if b.Current != b.TOC.Index() {
+		return
+	}
+	i := b.TOC.l.GetCurrentItem()
+	if i > b.TOC.l.GetItemCount() {
+		return
+	}
+	b.TOC.l.SetCurrentItem(i + 1)
+}
+
+func (b *Book) MenuUp() {
+	if b.Current != b.TOC.Index() {
+		return
+	}
+	i := b.TOC.l.GetCurrentItem()
+	if i == 0 {
+		return
+	}
+	b.TOC.l.SetCurrentItem(i - 1)
+}
+
+// ScrollBy scrolls the current chapter by n lines, backwards when n is
+// negative.
+func (b *Book) ScrollBy(n int) {
+	if b.Current == b.TOC.Index() {
+		return
+	}
+	r := b.Chapters[b.Current].GetOffset() + n
+	if r < 0 {
+		r = 0
+	}
+	b.Chapters[b.Current].SetOffset(r)
+}
+
+// PageHeight returns the number of visible lines in the current chapter, over
+// both columns when it is shown in two.
+func (b Book) PageHeight() int {
+	if b.Current == b.TOC.Index() {
+		return 0
+	}
+	c := b.Chapters[b.Current]
+	_, _, _, h := c.t.GetRect()
+	if c.columns {
+		return 2 * h
+	}
+
+	return h
+}
+
+func (b Book) jumpDistance() int {
+	if b.JumpDistance > 0 {
+		return b.JumpDistance
+	}
+
+	return b.PageHeight()
+}
+
+func (b *Book) LineDown() {
+	if b.Current == b.TOC.Index() {
+		b.MenuDown()
+		return
+	}
+	b.ScrollBy(1)
+}
+
+func (b *Book) LineUp() {
+	if b.Current == b.TOC.Index() {
+		b.MenuUp()
+		return
+	}
+	b.ScrollBy(-1)
+}
+
+func (b *Book) ScrollToTop() {
+	if b.Current == b.TOC.Index() {
+		return
+	}
+	b.Chapters[b.Current].SetOffset(0)
+}
+
+// ScrollToBottom scrolls so that the last line of the chapter is at the
+// bottom of the screen.
+func (b *Book) ScrollToBottom() {
+	if b.Current == b.TOC.Index() {
 		return
 	}
-
-	b.GoToPage(b.Current + 1)
-}
-
-func (b *Book) PreviousChapter() {
-	if b.Current-1 < b.TOC.Index() {
-		return
+	c := b.Chapters[b.Current]
+	n, err := c.t.NLines()
+	if err != nil {
+		c.t.ScrollToEnd()
+		return
+	}
+
+	r := n - b.PageHeight()
+	if r < 0 {
+		r = 0
+	}
+	c.SetOffset(r)
+}
+
+func (b *Book) JumpScroll() {
+	b.SmoothScrollBy(b.jumpDistance())
+}
+
+func (b *Book) JumpScrollBack() {
+	b.SmoothScrollBy(-b.jumpDistance())
+}
+
+func (b *Book) HalfPageDown() {
+	b.SmoothScrollBy(b.PageHeight() / 2)
+}
+
+func (b *Book) HalfPageUp() {
+	b.SmoothScrollBy(-b.PageHeight() / 2)
+}
+
+func (b *Book) PageDown() {
+	b.SmoothScrollBy(b.PageHeight())
+}
+
+func (b *Book) PageUp() {
+	b.SmoothScrollBy(-b.PageHeight())
+}
+
+const MinWidth = 20
+
+type Options struct {
+	Width    int
+	widthSet bool
+	WPM      int
+	// Jobs is the number of chapters converted concurrently in the
+	// background after opening a book, 0 to only convert chapters when
+	// opened.
+	Jobs int
+
+	// TOC and Info print the table of contents or the metadata instead of
+	// starting the reader.
+	TOC  bool
+	Info bool
+	// Export prints the text of the book instead of starting the reader,
+	// and TTS prints it one sentence per line for text-to-speech tools.
+	// Only the chapter selected by Chapter is printed when it is set, see
+	// findChapter. Otherwise, the reader opens at that chapter, Percent
+	// into it when set.
+	Export     bool
+	TTS        bool
+	Chapter    string
+	Percent    float64
+	percentSet bool
+	// Notes prints the notes attached to the books instead of starting the
+	// reader.
+	Notes bool
+	// StatusJSON prints the saved reading progress of the books as JSON
+	// instead of starting the reader.
+	StatusJSON bool
+	// DumpNotes prints the position, marks and notes of the books as JSON,
+	// and ImportNotes merges such a file into the state of the book,
+	// instead of starting the reader.
+	DumpNotes   bool
+	ImportNotes string
+	// Check reads every chapter of the books, reporting the ones that fail,
+	// instead of starting the reader.
+	Check bool
+	// Reset removes the saved state of the books, and ResetAll the saved
+	// states of all the books in the given directories, instead of starting
+	// the reader.
+	Reset    bool
+	ResetAll bool
+	// Restart opens books at the start, ignoring the saved position but
+	// keeping the marks, settings and reading statistics.
+	Restart bool
+	// Recent prints the recently opened books instead of starting the
+	// reader.
+	Recent bool
+	// recents is set when no book was given, fnames being the recently
+	// opened books which are always listed then.
+	recents bool
+
+	Config Config
+}
+
+func main() {
+	var opts Options
+
+	flag.IntVar(&opts.Width, "width", 80, "initial text width, overrides the saved width")
+	flag.BoolVar(&opts.TOC, "toc", false, "print the table of contents and exit")
+	flag.BoolVar(&opts.Info, "info", false, "print the book's metadata and exit")
+	flag.BoolVar(&opts.Export, "export", false, "print the text of the book, wrapped at the text width, and exit")
+	flag.BoolVar(&opts.TTS, "tts", false, "print the text of the book one sentence per line, for text-to-speech tools, and exit")
+	flag.StringVar(&opts.Chapter, "chapter", "", "open the book at the chapter with this number, or the first one whose title contains this text, or with -export or -tts only print it")
+	flag.Float64Var(&opts.Percent, "percent", 0, "open the chapter at this percentage of its length, with -chapter or in the chapter last read")
+	flag.BoolVar(&opts.Notes, "notes", false, "print the notes attached to the books and exit")
+	flag.BoolVar(&opts.DumpNotes, "dump-notes", false, "print the position, marks and notes of the books as JSON and exit")
+	flag.StringVar(&opts.ImportNotes, "import-notes", "", "merge the position, marks and notes from a JSON `file` printed by -dump-notes into the book's state and exit")
+	flag.BoolVar(&opts.StatusJSON, "status-json", false, "print the saved reading progress of the books as JSON and exit")
+	flag.BoolVar(&opts.Check, "check", false, "read every chapter of the books, report the ones that fail and exit")
+	flag.BoolVar(&opts.Reset, "reset", false, "delete the saved state of the books and exit")
+	flag.BoolVar(&opts.ResetAll, "reset-all", false, "delete the saved state of every book in the given directories and exit")
+	flag.BoolVar(&opts.Restart, "restart", false, "start the book over, keeping its marks and reading statistics")
+	flag.BoolVar(&opts.Recent, "recent", false, "print the recently opened books and exit")
+	flag.IntVar(&opts.Jobs, "jobs", runtime.NumCPU(), "number of chapters converted concurrently in the background, 0 to only convert chapters when opened")
+	flag.IntVar(&opts.WPM, "wpm", 0, "reading speed in words per minute, for reading time estimates (default from config, or 200)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] [filename...]\n", os.Args[0])
+		fmt.Fprintln(os.Stderr, "Without filename, the recently opened books are listed.")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "width":
+			opts.widthSet = true
+		case "percent":
+			opts.percentSet = true
+		}
+	})
+	if opts.Width < MinWidth {
+		fmt.Fprintf(os.Stderr, "invalid width %d: must be at least %d\n", opts.Width, MinWidth)
+		os.Exit(2)
+	}
+	if opts.Percent < 0 || opts.Percent > 100 {
+		fmt.Fprintf(os.Stderr, "invalid percent %g: must be between 0 and 100\n", opts.Percent)
+		os.Exit(2)
+	}
+	if opts.Jobs < 0 {
+		fmt.Fprintf(os.Stderr, "invalid jobs %d: must be positive\n", opts.Jobs)
+		os.Exit(2)
+	}
+	if opts.WPM < 0 {
+		fmt.Fprintf(os.Stderr, "invalid wpm %d: must be positive\n", opts.WPM)
+		os.Exit(2)
+	}
+
+	cfg, err := LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: loading config: %s\n", filepath.Base(os.Args[0]), err)
+		os.Exit(1)
+	}
+	opts.Config = cfg
+	classDecorations, _ = cfg.ClassDecorations()
+	textTransforms, _ = cfg.TextTransforms()
+	if opts.WPM == 0 {
+		opts.WPM = cfg.WPM
+	}
+
+	fnames := flag.Args()
+	if len(fnames) == 0 && !opts.Recent {
+		recents, err := LoadRecents()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: loading recent books: %s\n", filepath.Base(os.Args[0]), err)
+			os.Exit(1)
+		}
+		if len(recents) == 0 || opts.TOC || opts.Info || opts.Export || opts.TTS || opts.Notes || opts.StatusJSON || opts.DumpNotes || opts.ImportNotes != "" || opts.Check || opts.Reset || opts.ResetAll {
+			flag.Usage()
+			os.Exit(2)
+		}
+		fnames = recentFnames(recents)
+		opts.recents = true
+	}
+
+	err = run(fnames, opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", filepath.Base(os.Args[0]), err)
+		os.Exit(1)
+	}
+}
+
+func run(fnames []string, opts Options) error {
+	if opts.Recent {
+		return printRecents(os.Stdout)
+	}
+	if opts.Check {
+		return checkBooks(os.Stdout, fnames)
+	}
+	if opts.Reset {
+		return resetStates(os.Stdout, fnames)
+	}
+	if opts.ResetAll {
+		return resetAllStates(os.Stdout, fnames)
+	}
+	if opts.TOC {
+		return printTOC(os.Stdout, fnames)
+	}
+	if opts.Info {
+		return printInfo(os.Stdout, fnames, opts.Config.WordsPerPage)
+	}
+	if opts.StatusJSON {
+		return printStatusJSON(os.Stdout, fnames)
+	}
+	if opts.DumpNotes {
+		return printNotesDump(os.Stdout, fnames)
+	}
+	if opts.ImportNotes != "" {
+		if len(fnames) != 1 {
+			return fmt.Errorf("-import-notes takes a single book")
+		}
+		return importNotes(os.Stdout, fnames[0], opts.ImportNotes)
+	}
+	if opts.Notes {
+		return printNotes(os.Stdout, fnames)
+	}
+	if opts.Export {
+		for _, fname := range fnames {
+			err := exportBook(os.Stdout, fname, opts.Chapter, exportWidth(fname, opts))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if opts.TTS {
+		for _, fname := range fnames {
+			err := exportSpeech(os.Stdout, fname, opts.Chapter)
+			if err != nil {
+				return err
+			}
+		}
+		return nil
 	}
 
-	b.GoToPage(b.Current - 1)
-}
-
-func (b *Book) ToggleMenu() {
-	if b.Current == b.TOC.Index() {
-		b.GoToPage(b.menuContext)
-		return
+	_, warnings := opts.Config.KeyMap()
+	_, classWarnings := opts.Config.ClassDecorations()
+	_, transformWarnings := opts.Config.TextTransforms()
+	warnings = append(warnings, classWarnings...)
+	warnings = append(warnings, transformWarnings...)
+	for _, warning := range warnings {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s\n", filepath.Base(os.Args[0]), warning)
 	}
-	b.menuContext = b.Current
-	b.GoToPage(b.TOC.Index())
-}
 
-func (b *Book) MenuDown() {
-	if b.Current != b.TOC.Index() {
-		return
-	}
-	i := b.TOC.l.GetCurrentItem()
-	if i > b.TOC.l.GetItemCount() {
-		return
+	if len(fnames) == 1 && !opts.recents {
+		_, err := readBook(fnames[0], opts, false)
+		return err
 	}
-	b.TOC.l.SetCurrentItem(i + 1)
+
+	return runLibrary(fnames, opts)
 }
 
-func (b *Book) MenuUp() {
-	if b.Current != b.TOC.Index() {
-		return
+func openBook(fname string) (Reader, error) {
+	_, err := os.Stat(fname)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%s: no such file", fname)
 	}
-	i := b.TOC.l.GetCurrentItem()
-	if i == 0 {
-		return
+	if err != nil {
+		return nil, err
 	}
-	b.TOC.l.SetCurrentItem(i - 1)
-}
 
-func (b *Book) JumpScroll() {
-	if b.Current == b.TOC.Index() {
-		return
+	ebook, err := NewBook(fname)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
 	}
-	r := b.Chapters[b.Current].GetOffset()
-	b.Chapters[b.Current].SetOffset(r + 80)
-}
 
-func main() {
-	if len(os.Args) != 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s <filename>\n", os.Args[0])
-		os.Exit(2)
-	}
+	return ebook, nil
+}
 
-	ebook, err := NewBook(os.Args[1])
+// readBook opens fname in the reader until the user quits. When library is
+// set, the returned boolean reports whether the user asked to go back to the
+// library rather than quit.
+func readBook(fname string, opts Options, library bool) (bool, error) {
+	ebook, err := openBook(fname)
 	if err != nil {
-		panic(err)
+		return false, err
 	}
 	defer ebook.Close()
 
-	loadedState, stateExists, err := LoadState(os.Args[1])
+	loadedState, stateExists, err := LoadState(fname)
 	if err != nil {
-		panic(err)
+		return false, fmt.Errorf("%s: reading the state file: %s", stateFname(fname), err)
 	}
 
 	title, err := ebook.Metadata("title")
 	if err != nil {
-		panic(err)
+		return false, fmt.Errorf("%s: reading title: %s", fname, err)
 	}
 	if len(title) == 0 {
-		title = []string{filepath.Base(os.Args[1])}
+		title = []string{filepath.Base(fname)}
 	}
-
+	keys, _ := opts.Config.KeyMap()
 	book := &Book{
-		Title:       title[0],
-		Current:     -1,
-		menuContext: -1,
-		Width:       80,
-		MarkChapter: -1,
-		MarkLine:    -1,
+		fname:        fname,
+		ebook:        ebook,
+		Title:        title[0],
+		Current:      -1,
+		menuContext:  -1,
+		Width:        opts.Width,
+		Theme:        DefaultTheme,
+		Marks:        map[rune]Mark{},
+		Furthest:     map[int]float64{},
+		Keys:         keys,
+		Library:      library,
+		WPM:          opts.WPM,
+		ProgressMode: opts.Config.Progress,
+		ChapterSkip:  opts.Config.ChapterSkip,
+		WordsPerPage: opts.Config.WordsPerPage,
+		Margin:       opts.Config.Margin,
+		Dictionary:   opts.Config.Dictionary,
+		ScrollOff:    opts.Config.ScrollOff,
+		FocusLine:    opts.Config.FocusLine,
+		Scrollbar:    opts.Config.Scrollbar,
+		ConfirmQuit:  opts.Config.ConfirmQuit,
+		Mouse:        !opts.Config.DisableMouse,
+		SmoothScroll: opts.Config.SmoothScroll,
+		Hyphenate:    opts.Config.Hyphenate,
+		Sessions:     loadedState.Sessions + 1,
+		ReadingTime:  time.Duration(loadedState.TotalReadingSeconds) * time.Second,
+
+		ScrollDuration:    opts.Config.ScrollDuration(),
+		ChapterHistory:    opts.Config.ChapterHistory,
+		FocusLinePosition: opts.Config.FocusLinePosition,
+
+		HyphenationPatterns: opts.Config.HyphenationPatterns,
+		ParagraphIndent:     opts.Config.ParagraphIndent,
+		CitationStyle:       opts.Config.CitationStyle,
+	}
+	if stateExists && opts.Restart {
+		loadedState = loadedState.Restarted()
 	}
-
 	initialPage := -1
 	initialOffsets := map[int]int{}
 	if stateExists {
 		initialPage = loadedState.Page
 		initialOffsets = loadedState.Offsets
+		if opts.widthSet {
+			loadedState.Width = opts.Width
+		}
 	}
 
 	book.Initialize()
 
 	toc, err := ebook.TOC()
 	if err != nil {
-		panic(err)
+		return false, fmt.Errorf("%s: reading table of contents: %s", fname, err)
+	}
+	book.DetectLanguage(ebook, toc)
+	chapter, err := findChapter(toc, opts.Chapter)
+	if err != nil {
+		return false, fmt.Errorf("%s: %s", fname, err)
+	}
+
+	book.flashFallbackTOC()
+	if loadedState.Version > stateVersion {
+		book.Flash("the state was saved by a newer version, some of it may be lost")
 	}
 
 	book.GenerateTOC(toc, initialPage)
 
 	for i, entry := range toc {
-		err = book.GenerateChapter(
+		book.GenerateChapter(
 			ebook, i, entry.URL,
 			initialPage, initialOffsets[i],
-			fmt.Sprintf("%q (%.2f%%)", entry.Name, 100*float64(i)/float64(len(toc))),
+			entry.Name,
 			func(fn func()) { book.app.QueueUpdateDraw(fn) },
 			// func(fn func()) { book.app.QueueUpdate(fn) },
 		)
-		if err != nil {
-			panic(err)
-		}
+		book.Chapters[i].nonLinear = entry.NonLinear
 	}
 
 	if stateExists {
 		book.LoadState(loadedState)
+	} else {
+		if opts.Config.SkipFrontMatter {
+			if idx := firstContentChapter(ebook, toc); idx != -1 {
+				book.menuContext = idx
+				book.GoToPage(idx)
+			}
+		}
+		if opts.Config.Cover {
+			book.ShowInfo()
+		}
+	}
+	if chapter != -1 {
+		book.menuContext = chapter
+		book.GoToPage(chapter)
+		book.Chapters[chapter].SetOffset(0)
+	}
+	if opts.percentSet && book.Current != book.TOC.Index() {
+		book.Chapters[book.Current].SetFraction(opts.Percent / 100)
 	}
+	if opts.Config.NightFrom != opts.Config.NightUntil {
+		book.SetNight(isNight(time.Now().Hour(), opts.Config.NightFrom, opts.Config.NightUntil))
+	}
+
+	book.finishedBefore = book.finishedChapters()
+	if opts.Jobs > 0 {
+		book.Preload(opts.Jobs)
+	}
+
+	stop := make(chan struct{})
+	if interval := opts.Config.AutosaveInterval(); interval > 0 {
+		go book.autosave(fname, interval, stop)
+	}
+	if opts.Config.IdleTimeoutSeconds > 0 {
+		book.activity = make(chan struct{}, 1)
+		go book.quitWhenIdle(time.Duration(opts.Config.IdleTimeoutSeconds)*time.Second, stop)
+	}
+	go book.stopOnSignal(stop)
 
 	err = book.Run()
+	close(stop)
+	book.removeTempFiles()
 	if err != nil {
-		panic(err)
+		// make sure the terminal is restored before the error is printed
+		book.app.Stop()
+		return false, err
 	}
 
 	state := book.State()
 
-	err = SaveState(os.Args[1], state)
+	err = SaveState(fname, state)
+	if err != nil {
+		return false, fmt.Errorf("%s: saving state: %s", stateFname(fname), err)
+	}
+
+	err = updateRecents(fname, book.Title, book.FurthestProgress())
+	if err != nil {
+		return false, fmt.Errorf("saving recent books: %s", err)
+	}
+
+	err = book.recordActivity()
 	if err != nil {
-		panic(err)
+		return false, fmt.Errorf("saving reading activity: %s", err)
+	}
+
+	err = ebook.SaveCache()
+	if err != nil {
+		return false, fmt.Errorf("%s: saving cache: %s", cacheFname(fname), err)
+	}
+
+	return book.backToLibrary, nil
+}
+
+// flashFallbackTOC tells when the table of contents had to be built from the
+// reading order, the book having no usable one.
+func (b *Book) flashFallbackTOC() {
+	if fallback, ok := b.ebook.(*EBook); ok && fallback.FallbackTOC {
+		b.Flash("no usable table of contents, chapters are listed in reading order")
+	}
+}
+
+// stateDir returns the directory holding the state files, from
+// $LECTERN_STATE_DIR or $XDG_STATE_HOME/lectern, or an empty string if
+// neither is set and states are kept next to the books.
+func stateDir() string {
+	if dir := os.Getenv("LECTERN_STATE_DIR"); dir != "" {
+		return dir
 	}
+	if dir := os.Getenv("XDG_STATE_HOME"); dir != "" {
+		return filepath.Join(dir, "lectern")
+	}
+
+	return ""
 }
 
+// stateFname returns the state file of the book. In the state directory, it
+// is named after a hash of the book's absolute path, so that books with the
+// same name don't share it.
 func stateFname(bookFname string) string {
+	dir := stateDir()
+	if dir == "" {
+		return sidecarStateFname(bookFname)
+	}
+
+	return filepath.Join(dir, bookID(bookFname)+".json")
+}
+
+// bookID names the files kept about the book away from it after its name
+// and a hash of its absolute path, so that books with the same name don't
+// share them.
+func bookID(bookFname string) string {
+	abs, err := filepath.Abs(bookFname)
+	if err != nil {
+		abs = bookFname
+	}
+	sum := sha256.Sum256([]byte(abs))
+
+	return filepath.Base(bookFname) + "-" + hex.EncodeToString(sum[:8])
+}
+
+// sidecarStateFname returns the state file kept next to the book, used when
+// no state directory is set.
+func sidecarStateFname(bookFname string) string {
+	bookFname = filepath.Clean(bookFname)
+
 	return filepath.Join(
 		filepath.Dir(bookFname),
 		"."+filepath.Base(bookFname)+".lectern.json",
 	)
 }
 
+// LoadState reads the saved state of the book. With a state directory set, a
+// state file left next to the book is read when the directory has none, the
+// state being saved to the directory from then on.
 func LoadState(bookFname string) (State, bool, error) {
 	var state State
 
 	fname := stateFname(bookFname)
 
 	f, err := os.Open(fname)
+	if os.IsNotExist(err) && fname != sidecarStateFname(bookFname) {
+		fname = sidecarStateFname(bookFname)
+		f, err = os.Open(fname)
+	}
 	if os.IsNotExist(err) {
 		return state, false, nil
 	}
 	if err != nil {
 		return state, true, err
 	}
-	defer f.Close()
 
 	dec := json.NewDecoder(f)
 	err = dec.Decode(&state)
+	f.Close()
 	if err != nil {
-		return state, true, err
+		// a corrupt state file would keep the book from being opened,
+		// it is put aside and the book opened as if it never was
+		backupCorruptState(fname, err)
+		return State{}, false, nil
+	}
+
+	return migrateState(state), true, nil
+}
+
+// backupCorruptState moves a state file that couldn't be decoded to a .bak
+// file next to it, warning about it. Backups of earlier corruptions are kept,
+// the new one being numbered after them.
+func backupCorruptState(fname string, decodeErr error) {
+	backup := fname + ".bak"
+	for n := 1; ; n++ {
+		if _, err := os.Lstat(backup); os.IsNotExist(err) {
+			break
+		}
+		backup = fmt.Sprintf("%s.bak.%d", fname, n)
+	}
+	err := os.Rename(fname, backup)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s: warning: %s: corrupt state file (%s), ignored: %s\n", filepath.Base(os.Args[0]), fname, decodeErr, err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s: warning: %s: corrupt state file (%s), moved to %s\n", filepath.Base(os.Args[0]), fname, decodeErr, backup)
+}
+
+// stateVersion is the version of the state format, bumped when older state
+// files need to be migrated.
+const stateVersion = 3
+
+// migrateState upgrades a state saved by an older version to the current
+// format. States saved by newer versions are left as is, the fields known to
+// this version being used as far as possible.
+func migrateState(state State) State {
+	if state.Version > stateVersion {
+		return state
+	}
+
+	if state.Version < 1 {
+		// the furthest positions weren't recorded, the current ones are
+		// the best guess
+		state.Furthest = map[int]float64{}
+		for idx, f := range state.Fractions {
+			state.Furthest[idx] = f
+		}
+		if state.Offsets == nil {
+			state.Offsets = map[int]int{}
+		}
+	}
+	if state.Version < 2 {
+		// the table of contents followed the current chapter
+		state.TOCSelected = state.Page
+	}
+	if state.Version < 3 {
+		// the lines of the text are found from the lines as shown once
+		// the chapters are rendered
+		for name, m := range state.Marks {
+			m.SourceLine = -1
+			state.Marks[name] = m
+		}
+		for i := range state.Notes {
+			state.Notes[i].SourceLine = -1
+		}
 	}
+	state.Version = stateVersion
 
-	return state, true, nil
+	return state
 }
 
+// SaveState saves the state of the book, stamping it with the current time.
 func SaveState(bookFname string, state State) error {
+	state.LastRead = time.Now()
+
+	return writeState(bookFname, state)
+}
+
+// writeState writes the state of the book as is.
+func writeState(bookFname string, state State) error {
 	fname := stateFname(bookFname)
+	err := os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return err
+	}
 
-	f, err := os.Create(fname)
+	return writeJSON(fname, state)
+}
+
+// writeJSON encodes v to fname through a temporary file renamed over it, so
+// that concurrent or interrupted writes never leave a truncated file behind.
+func writeJSON(fname string, v interface{}) error {
+	f, err := ioutil.TempFile(filepath.Dir(fname), "."+filepath.Base(fname)+".*.tmp")
 	if err != nil {
 		return err
 	}
-	defer f.Close()
+	defer os.Remove(f.Name())
 
 	enc := json.NewEncoder(f)
-	err = enc.Encode(state)
+	err = enc.Encode(v)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
 
-	return err
+	return os.Rename(f.Name(), fname)
 }
 
 type State struct {
-	Page    int
-	Offsets map[int]int
-	Width   int
+	// Version is the version of the format the state was saved in,
+	// stateVersion for the current one, 0 for states saved before it was
+	// introduced.
+	Version int
+
+	Page int
+	// TOCSelected is the chapter selected in the table of contents, which
+	// stays where it was browsed to when reading other chapters.
+	TOCSelected int
+	Offsets     map[int]int
+	// Fractions holds the scrolled fraction of each chapter, which unlike
+	// Offsets doesn't depend on the width the text was wrapped at. Offsets
+	// is used for chapters missing from it.
+	Fractions map[int]float64
+	Width     int
+	Theme     string
+	Night     bool
+	Spacing   int
+	Direction string
+	Wrap      string
+	Columns   bool
+	FocusMode bool
+	Zoom      int
+	Marks     map[rune]Mark
+	Notes     []Note
+	// Furthest holds the furthest fraction scrolled in each chapter opened,
+	// FurthestProgress being computed from it.
+	Furthest map[int]float64
+	// Words caches the number of words in each chapter, so that they are
+	// only counted again when the book changes.
+	Words *WordCounts
+
+	// LastRead is the time the state was last saved, and Sessions the number
+	// of times the book was opened. Both are zero in state files saved by
+	// older versions.
+	LastRead time.Time
+	Sessions int
+	// TotalReadingSeconds is the time spent reading the book, over all
+	// sessions.
+	TotalReadingSeconds int64
 }
 
-func renderTOC(width int, toc []TOCEntry, cb func(int)) (*tview.Grid, *tview.List) {
+// Restarted returns the state without the reading position, starting the
+// book over from the table of contents. Marks, settings and statistics are
+// kept.
+func (s State) Restarted() State {
+	s.Page = -1
+	s.Offsets = nil
+	s.Fractions = nil
+	s.Furthest = nil
+
+	return s
+}
+
+func renderTOC(theme Theme, width int, toc []TOCEntry, cb func(int)) (*tview.Grid, *tview.List) {
 	l := tview.NewList()
-	l.SetBackgroundColor(BackgroundColor)
+	applyListTheme(l, theme)
 	for i, entry := range toc {
 		u := entry.URL
 		j := i
@@ -490,7 +2032,7 @@ func renderTOC(width int, toc []TOCEntry, cb func(int)) (*tview.Grid, *tview.Lis
 
 	g := tview.NewGrid()
 	g.SetColumns(-1, width, -1)
-	g.SetBackgroundColor(BackgroundColor)
+	g.SetBackgroundColor(theme.Background)
 
 	g.Clear()
 	g.AddItem(l, 0, 1, 1, 1, 0, 0, true)
@@ -498,87 +2040,84 @@ func renderTOC(width int, toc []TOCEntry, cb func(int)) (*tview.Grid, *tview.Lis
 	return g, l
 }
 
-func renderChapter(width int, book *EBook, u string, progress string, queueFn func(func())) (*tview.Grid, *tview.TextView, error) {
-	text := tview.NewTextView()
-	text.SetBackgroundColor(BackgroundColor)
-	text.SetTextColor(tcell.ColorDefault)
-	text.SetWrap(true)
-	text.SetWordWrap(true)
-
-	b, err := book.ReadChapter(u)
-	if err != nil {
-		return nil, nil, err
-	}
-	text.SetText(b)
+func renderChapter(theme Theme, width, margin int, s string) (*tview.Grid, *tview.TextView) {
+	text := newChapterText(theme, s)
 
 	g := tview.NewGrid()
 	g.SetColumns(-1, width, -1)
-	g.SetRows(-1, 1, 1)
-	g.SetBackgroundColor(BackgroundColor)
-
-	g.Clear()
-	g.AddItem(text, 0, 1, 1, 1, 0, 0, true)
+	g.SetBackgroundColor(theme.Background)
+	layoutChapter(g, margin, text)
 
-	progressText := tview.NewTextView()
-	progressText.SetBackgroundColor(BackgroundColor)
-	progressText.SetTextColor(tcell.ColorDefault)
-	progressText.SetText(progress)
-	progressText.SetTextAlign(tview.AlignCenter)
-
-	g.AddItem(progressText, 2, 1, 1, 1, 0, 0, false)
+	return g, text
+}
 
-	justUpdated := false
-	setLine := func(currentLine int) {
-		queueFn(func() {
-			newLine, _ := text.GetScrollOffset()
+func newChapterText(theme Theme, s string) *tview.TextView {
+	text := tview.NewTextView()
+	text.SetBackgroundColor(theme.Background)
+	text.SetTextColor(theme.Foreground)
+	text.SetWrap(true)
+	text.SetWordWrap(true)
+	text.SetDynamicColors(true)
+	text.SetText(tview.Escape(s))
 
-			if newLine == currentLine {
-				return
-			}
-			_, _, _, h := text.GetRect()
+	return text
+}
 
-			nLines, err := text.NLines()
-			if err != nil {
-				progressText.SetText(fmt.Sprintf("%s - lines %d-%d", progress, newLine+1, newLine+h+1))
-			} else {
-				if newLine+h >= nLines {
-					h = nLines - newLine - 1
-				}
-				progressText.SetText(fmt.Sprintf("%s - lines %d-%d/%d", progress, newLine+1, newLine+h+1, nLines))
-			}
-		})
+// layoutChapter places the chapter text in the middle column of g, with
+// margin blank lines above and below. With a second column, the text views
+// are placed on both sides of the gap column, the first one having the
+// focus.
+func layoutChapter(g *tview.Grid, margin int, columns ...*tview.TextView) {
+	g.Clear()
+	row := 0
+	if margin <= 0 {
+		g.SetRows(-1)
+	} else {
+		g.SetRows(margin, -1, margin)
+		row = 1
 	}
 
-	text.SetDrawFunc(func(screen tcell.Screen, x, y, width, height int) (int, int, int, int) {
-		if !justUpdated {
-			setLine(-1)
-			justUpdated = true
-		} else {
-			justUpdated = false
-		}
-		return x, y, width, height
-	})
-
-	return g, text, nil
+	for i, text := range columns {
+		g.AddItem(text, row, 1+2*i, 1, 1, 0, 0, i == 0)
+	}
 }
 
 type EBook struct {
 	*epubgo.Epub
 	Title string
 
-	it *epubgo.SpineIterator
+	fname string
+
+	// spine maps the URL of each spine item to a function opening it, in
+	// place of the stateful SpineIterator.
+	spine     map[string]func() (io.ReadCloser, error)
+	spineURLs []string
+	// nonLinear holds the URLs of the spine items marked linear="no".
+	nonLinear map[string]bool
+	// encryption lists the obfuscated fonts, de-obfuscated by ReadFile.
+	encryption Encryption
+
+	mu    sync.Mutex
+	cache *Cache
+
+	// FallbackTOC is set once TOC had to build the table of contents from
+	// the reading order.
+	FallbackTOC bool
 }
 
 type TOCEntry struct {
 	Name string
 	URL  string
+	// NonLinear is set for the entries of auxiliary spine items, like notes,
+	// which are only reached through links rather than in reading order.
+	NonLinear bool
 }
 
-func NewBook(fname string) (*EBook, error) {
-
+// NewEBook opens the EPUB file fname.
+func NewEBook(fname string) (*EBook, error) {
 	book, err := epubgo.Open(fname)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("not a valid EPUB: %s", err)
 	}
 
 	title, err := book.Metadata("title")
@@ -590,67 +2129,180 @@ func NewBook(fname string) (*EBook, error) {
 		title = []string{""}
 	}
 
-	it, err := book.Spine()
+	spine, spineURLs, err := indexSpine(book)
+	if err != nil {
+		book.Close()
+		return nil, err
+	}
+	encryption, err := readEncryption(fname, spineURLs)
 	if err != nil {
 		book.Close()
 		return nil, err
 	}
+	// a spine that can't be read is already reported by epubgo, every item
+	// is then part of the reading order
+	nonLinear, _ := nonLinearItems(fname)
 
 	return &EBook{
-		Epub:  book,
-		Title: title[0],
-		it:    it,
+		Epub:       book,
+		Title:      title[0],
+		fname:      fname,
+		spine:      spine,
+		spineURLs:  spineURLs,
+		nonLinear:  nonLinear,
+		encryption: encryption,
 	}, nil
 }
 
-func (b *EBook) ReadCurrentChapter() (string, error) {
-	r, err := b.it.Open()
+func indexSpine(book *epubgo.Epub) (map[string]func() (io.ReadCloser, error), []string, error) {
+	it, err := book.Spine()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	spine := map[string]func() (io.ReadCloser, error){}
+	urls := []string{}
+	for {
+		u := it.URL()
+		spine[u] = func() (io.ReadCloser, error) {
+			return book.OpenFile(u)
+		}
+		urls = append(urls, u)
+
+		if it.IsLast() {
+			break
+		}
+		err = it.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return spine, urls, nil
+}
+
+// chapterPath strips the fragment from a chapter URL.
+func chapterPath(u string) string {
+	return strings.SplitN(u, "#", 2)[0]
+}
+
+// urlFragment returns the fragment of a chapter URL, empty if it has none.
+func urlFragment(u string) string {
+	parts := strings.SplitN(u, "#", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+
+	return parts[1]
+}
+
+// ReadChapter returns the text of the chapter at the given URL, without its
+// inline formatting. It is safe for concurrent use.
+func (b *EBook) ReadChapter(u string) (string, error) {
+	content, err := b.ReadContent(u)
+
+	return stripMarkup(content.Text), err
+}
+
+// ReadContent returns the content converted from the chapter at the given
+// URL. It is safe for concurrent use.
+func (b *EBook) ReadContent(u string) (Content, error) {
+	u = chapterPath(u)
+
+	open, ok := b.spine[u]
+	if !ok {
+		return Content{}, fmt.Errorf("chapter %q not found", u)
+	}
+
+	r, err := open()
 	if err != nil {
-		return "", err
+		return Content{}, err
 	}
 	defer r.Close()
 
 	buf, err := ioutil.ReadAll(r)
 	if err != nil {
-		return "", err
+		return Content{}, err
+	}
+
+	hash := contentHash(buf)
+	b.mu.Lock()
+	if b.cache == nil {
+		b.cache = LoadCache(b.fname)
+	}
+	content, ok := b.cache.Get(u, hash)
+	b.mu.Unlock()
+	if ok {
+		return content, nil
+	}
+
+	content, err = convertHTML(u, buf)
+	if err != nil {
+		return Content{}, err
 	}
 
-	return html2text.HTML2Text(string(buf)), nil
+	b.mu.Lock()
+	b.cache.Set(u, hash, content)
+	b.mu.Unlock()
+
+	return content, nil
 }
 
-func (b *EBook) ReadChapter(u string) (string, error) {
-	current := b.it.URL()
+// ReadFile reads the file at u, relative to the package document,
+// de-obfuscating it if it is an obfuscated font.
+func (b *EBook) ReadFile(u string) ([]byte, error) {
+	r, err := b.OpenFile(chapterPath(u))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
 
-	for {
-		if b.it.URL() == u {
-			return b.ReadCurrentChapter()
-		}
-		if b.it.IsFirst() {
-			break
-		}
-		err := b.it.Previous()
-		if err != nil {
-			return "", err
-		}
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if algorithm, ok := b.encryption.Obfuscated[path.Clean(chapterPath(u))]; ok {
+		return deobfuscate(algorithm, b.encryption.Identifier, buf)
 	}
 
-	for {
-		if b.it.URL() == u {
-			return b.ReadCurrentChapter()
-		}
-		if b.it.IsLast() {
-			break
-		}
-		err := b.it.Next()
-		if err != nil {
-			return "", err
-		}
+	return buf, nil
+}
+
+// SaveCache writes the converted chapters back to the disk cache, if any
+// were converted since it was loaded.
+func (b *EBook) SaveCache() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.cache == nil {
+		return nil
 	}
 
-	return b.ReadChapter(current)
+	return b.cache.Save()
 }
 
+// TOC returns the table of contents of the book, built from the reading
+// order when the navigation document is missing, broken or empty.
 func (b *EBook) TOC() ([]TOCEntry, error) {
+	toc, err := b.navigationTOC()
+	if err != nil {
+		toc = nil
+	}
+	// the EPUB3 navigation document is preferred to the NCX, unless it
+	// lists fewer entries
+	if nav, err := b.navDocumentTOC(); err == nil && len(nav) > 0 && len(nav) >= len(toc) {
+		toc = nav
+	}
+	if len(toc) > 0 {
+		return b.markNonLinear(b.mergeSpine(toc)), nil
+	}
+
+	b.FallbackTOC = true
+
+	return b.markNonLinear(b.spineTOC()), nil
+}
+
+func (b *EBook) navigationTOC() ([]TOCEntry, error) {
 	it, err := b.Epub.Navigation()
 	if err != nil {
 		return nil, err
@@ -674,3 +2326,34 @@ func (b *EBook) TOC() ([]TOCEntry, error) {
 
 	return toc, nil
 }
+
+// spineTOC lists the spine items in reading order, named after their first
+// heading or title, or numbered when they have none.
+func (b *EBook) spineTOC() []TOCEntry {
+	toc := make([]TOCEntry, 0, len(b.spineURLs))
+	for i, u := range b.spineURLs {
+		toc = append(toc, b.spineEntry(i, u))
+	}
+
+	return toc
+}
+
+// spineEntry returns the table of contents entry of the spine item i at u.
+func (b *EBook) spineEntry(i int, u string) TOCEntry {
+	name := ""
+	if r, err := b.spine[u](); err == nil {
+		buf, err := ioutil.ReadAll(r)
+		r.Close()
+		if err == nil {
+			name = documentTitle(buf)
+		}
+	}
+	if name == "" {
+		name = fmt.Sprintf("Chapter %d", i+1)
+	}
+
+	return TOCEntry{
+		Name: name,
+		URL:  u,
+	}
+}
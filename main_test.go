@@ -0,0 +1,365 @@
+package main
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// tempStateDir creates a temporary directory used as the state directory,
+// returning it along with a function removing it and restoring the
+// environment.
+func tempStateDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "lectern-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stateDirEnv, xdgEnv := os.Getenv("LECTERN_STATE_DIR"), os.Getenv("XDG_STATE_HOME")
+	os.Setenv("LECTERN_STATE_DIR", dir)
+	os.Unsetenv("XDG_STATE_HOME")
+
+	return dir, func() {
+		os.Setenv("LECTERN_STATE_DIR", stateDirEnv)
+		os.Setenv("XDG_STATE_HOME", xdgEnv)
+		os.RemoveAll(dir)
+	}
+}
+
+// writeEPUB writes the EPUB book.epub to dir, holding the files keyed by
+// their path in the archive along with its mimetype and a container file
+// pointing to content.opf.
+func writeEPUB(t *testing.T, dir string, files map[string]string) string {
+	fname := filepath.Join(dir, "book.epub")
+	f, err := os.Create(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	z := zip.NewWriter(f)
+	w, err := z.CreateHeader(&zip.FileHeader{Name: "mimetype", Method: zip.Store})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte("application/epub+zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files["META-INF/container.xml"] = `<?xml version="1.0"?>
+<container version="1.0" xmlns="urn:oasis:names:tc:opendocument:xmlns:container">
+  <rootfiles>
+    <rootfile full-path="content.opf" media-type="application/oebps-package+xml"/>
+  </rootfiles>
+</container>`
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		w, err := z.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = w.Write([]byte(files[name]))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = z.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fname
+}
+
+// xhtml returns an XHTML document titled title with the body.
+func xhtml(title, body string) string {
+	return `<?xml version="1.0" encoding="utf-8"?>
+<html xmlns="http://www.w3.org/1999/xhtml" xmlns:epub="http://www.idpf.org/2007/ops">
+<head><title>` + title + `</title></head>
+<body>` + body + `</body>
+</html>`
+}
+
+// newTestBook returns a book showing the table of contents toc of r, with
+// its chapters generated but not loaded.
+func newTestBook(r Reader, toc []TOCEntry) *Book {
+	b := &Book{
+		ebook:       r,
+		Current:     -1,
+		menuContext: -1,
+		Width:       40,
+		Theme:       DefaultTheme,
+		Marks:       map[rune]Mark{},
+		Furthest:    map[int]float64{},
+	}
+	b.Initialize()
+	b.GenerateTOC(toc, -1)
+	for i, entry := range toc {
+		b.GenerateChapter(r, i, entry.URL, -1, 0, entry.Name, func(fn func()) { fn() })
+	}
+
+	return b
+}
+
+func TestSharedURLChapters(t *testing.T) {
+	dir, cleanup := tempStateDir(t)
+	defer cleanup()
+
+	var body strings.Builder
+	body.WriteString(`<h1 id="one">One</h1>`)
+	for i := 0; i < 20; i++ {
+		body.WriteString(`<p>The first part goes on and on, long enough to be wrapped over several lines.</p>`)
+	}
+	body.WriteString(`<h1 id="two">Two</h1><p>The second part.</p>`)
+	fname := writeEPUB(t, dir, map[string]string{
+		"content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Shared</dc:title>
+    <dc:identifier id="id">shared</dc:identifier>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="chapter" href="chapter.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="chapter"/>
+  </spine>
+</package>`,
+		"toc.ncx": `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <navMap>
+    <navPoint id="p1" playOrder="1"><navLabel><text>One</text></navLabel><content src="chapter.xhtml#one"/></navPoint>
+    <navPoint id="p2" playOrder="2"><navLabel><text>Two</text></navLabel><content src="chapter.xhtml#two"/></navPoint>
+    <navPoint id="p3" playOrder="3"><navLabel><text>Two again</text></navLabel><content src="chapter.xhtml#two"/></navPoint>
+  </navMap>
+</ncx>`,
+		"chapter.xhtml": xhtml("Shared", body.String()),
+	})
+
+	ebook, err := NewEBook(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ebook.Close()
+	toc, err := ebook.TOC()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(toc) != 3 {
+		t.Fatalf("TOC() = %+v, expected 3 entries", toc)
+	}
+
+	b := newTestBook(ebook, toc)
+	ids := map[string]int{}
+	for i, c := range b.Chapters {
+		if j, ok := ids[c.ID()]; ok {
+			t.Errorf("chapters %d and %d share the page %q", j, i, c.ID())
+		}
+		ids[c.ID()] = i
+		if b.IndexToID(i) != c.ID() {
+			t.Errorf("IndexToID(%d) = %q, expected %q", i, b.IndexToID(i), c.ID())
+		}
+	}
+
+	for i, c := range b.Chapters {
+		// opened before being loaded, like when following the table of
+		// contents
+		id := urlFragment(c.URL())
+		c.ScrollToAnchor(id)
+		content, err := ebook.ReadContent(c.URL())
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.setContent(c, content)
+
+		if line := c.sourceLine(c.GetOffset()); line != content.Anchors[id] {
+			t.Errorf("chapter %d scrolled to line %d, expected the line %d of #%s", i, line, content.Anchors[id], id)
+		}
+	}
+	if b.Chapters[0].GetOffset() == b.Chapters[1].GetOffset() {
+		t.Errorf("chapters 0 and 1 both scrolled to %d", b.Chapters[0].GetOffset())
+	}
+}
+
+func TestMigrateState(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		state    State
+		expected State
+	}{
+		{
+			name: "v0",
+			state: State{
+				Page:      3,
+				Fractions: map[int]float64{1: 0.5, 3: 0.25},
+			},
+			expected: State{
+				Version:     stateVersion,
+				Page:        3,
+				TOCSelected: 3,
+				Offsets:     map[int]int{},
+				Fractions:   map[int]float64{1: 0.5, 3: 0.25},
+				Furthest:    map[int]float64{1: 0.5, 3: 0.25},
+			},
+		},
+		{
+			name: "v1",
+			state: State{
+				Version:   1,
+				Page:      2,
+				Offsets:   map[int]int{2: 10},
+				Fractions: map[int]float64{2: 0.5},
+				Furthest:  map[int]float64{2: 0.75},
+			},
+			expected: State{
+				Version:     stateVersion,
+				Page:        2,
+				TOCSelected: 2,
+				Offsets:     map[int]int{2: 10},
+				Fractions:   map[int]float64{2: 0.5},
+				Furthest:    map[int]float64{2: 0.75},
+			},
+		},
+		{
+			name: "v2",
+			state: State{
+				Version:     2,
+				Page:        2,
+				TOCSelected: 5,
+				Marks:       map[rune]Mark{'a': {Chapter: 2, Line: 40}},
+				Notes:       []Note{{Chapter: 2, Line: 30, Text: "note"}},
+			},
+			expected: State{
+				Version:     stateVersion,
+				Page:        2,
+				TOCSelected: 5,
+				Marks:       map[rune]Mark{'a': {Chapter: 2, Line: 40, SourceLine: -1}},
+				Notes:       []Note{{Chapter: 2, Line: 30, SourceLine: -1, Text: "note"}},
+			},
+		},
+		{
+			name: "current",
+			state: State{
+				Version:     stateVersion,
+				Page:        2,
+				TOCSelected: 5,
+				Fractions:   map[int]float64{2: 0.5},
+				Furthest:    map[int]float64{2: 0.75},
+			},
+			expected: State{
+				Version:     stateVersion,
+				Page:        2,
+				TOCSelected: 5,
+				Fractions:   map[int]float64{2: 0.5},
+				Furthest:    map[int]float64{2: 0.75},
+			},
+		},
+		{
+			name: "newer",
+			state: State{
+				Version:     stateVersion + 1,
+				Page:        2,
+				TOCSelected: 5,
+				Fractions:   map[int]float64{2: 0.5},
+			},
+			expected: State{
+				Version:     stateVersion + 1,
+				Page:        2,
+				TOCSelected: 5,
+				Fractions:   map[int]float64{2: 0.5},
+			},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			actual := migrateState(test.state)
+			if !reflect.DeepEqual(actual, test.expected) {
+				t.Errorf("migrateState(%+v) = %+v, expected %+v", test.state, actual, test.expected)
+			}
+		})
+	}
+}
+
+func TestLoadStateNewerVersion(t *testing.T) {
+	dir, cleanup := tempStateDir(t)
+	defer cleanup()
+	book := filepath.Join(dir, "book.epub")
+
+	buf := []byte(`{"Version": 99, "Page": 2, "TOCSelected": 5, "Bookmarks": {"a": 1}}`)
+	err := ioutil.WriteFile(stateFname(book), buf, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	state, loaded, err := LoadState(book)
+	if err != nil {
+		t.Fatalf("LoadState: %s", err)
+	}
+	if !loaded {
+		t.Fatal("LoadState: state not loaded")
+	}
+	// readBook warns about states saved by newer versions
+	if state.Version <= stateVersion {
+		t.Errorf("state.Version = %d, expected it to be kept at 99", state.Version)
+	}
+	if state.Page != 2 || state.TOCSelected != 5 {
+		t.Errorf("state = %+v, expected Page 2 and TOCSelected 5", state)
+	}
+}
+
+func TestLoadStateCorrupt(t *testing.T) {
+	dir, cleanup := tempStateDir(t)
+	defer cleanup()
+	book := filepath.Join(dir, "book.epub")
+	fname := stateFname(book)
+
+	corruptions := [][]byte{
+		// truncated
+		[]byte(`{"Version": 2, "Page": 3, "Offs`),
+		// wrong type
+		[]byte(`{"Version": 2, "Page": "three"}`),
+		[]byte(`[]`),
+	}
+	backups := []string{fname + ".bak", fname + ".bak.1", fname + ".bak.2"}
+	for i, buf := range corruptions {
+		err := ioutil.WriteFile(fname, buf, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state, loaded, err := LoadState(book)
+		if err != nil {
+			t.Fatalf("LoadState(%q): %s", buf, err)
+		}
+		if loaded {
+			t.Errorf("LoadState(%q): corrupt state loaded", buf)
+		}
+		if !reflect.DeepEqual(state, State{}) {
+			t.Errorf("LoadState(%q) = %+v, expected an empty state", buf, state)
+		}
+		if _, err := os.Stat(fname); !os.IsNotExist(err) {
+			t.Errorf("LoadState(%q): corrupt state left in place", buf)
+		}
+
+		for j, backup := range backups[:i+1] {
+			actual, err := ioutil.ReadFile(backup)
+			if err != nil {
+				t.Fatalf("reading backup: %s", err)
+			}
+			if string(actual) != string(corruptions[j]) {
+				t.Errorf("%s holds %q, expected %q", filepath.Base(backup), actual, corruptions[j])
+			}
+		}
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"time"
+	"unicode"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+type Mark struct {
+	Chapter int
+	// Line is the line as shown, kept in sync with SourceLine whenever the
+	// chapter is rendered, and SourceLine the line of the chapter's text,
+	// which doesn't depend on the width. SourceLine is -1 for marks saved
+	// by older versions until their chapter is rendered.
+	Line       int
+	SourceLine int
+	// Preview is the start of the text at the mark when it was set, empty
+	// for marks saved by older versions.
+	Preview string
+	// Time is when the mark was set, zero for marks saved by older
+	// versions.
+	Time time.Time
+}
+
+func (b *Book) SetMark(r rune) {
+	if !unicode.IsLetter(r) {
+		return
+	}
+	if b.Current == b.TOC.Index() {
+		return
+	}
+
+	// the mark is on the line jumping to it shows ScrollOff lines below the
+	// top, so that setting it again where it was jumped to doesn't move it
+	c := b.Chapters[b.Current]
+	line := c.GetOffset() + b.ScrollOff
+	b.Marks[r] = Mark{
+		Chapter:    b.Current,
+		Line:       line,
+		SourceLine: c.sourceLine(line),
+		Preview:    c.lineText(line),
+		Time:       time.Now(),
+	}
+}
+
+func (b *Book) JumpToMark(r rune) {
+	m, ok := b.Marks[r]
+	if !ok {
+		return
+	}
+	if m.Chapter < 0 || m.Chapter >= len(b.Chapters) {
+		return
+	}
+
+	b.recordJump()
+	b.Chapters[m.Chapter].scrollToPosition(m.Line, m.SourceLine, b.ScrollOff)
+	if b.Current != m.Chapter {
+		b.GoToPage(m.Chapter)
+	}
+}
+
+func (b Book) markNames() []rune {
+	names := make([]rune, 0, len(b.Marks))
+	for r := range b.Marks {
+		names = append(names, r)
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return names[i] < names[j]
+	})
+
+	return names
+}
+
+// NextMark jumps to the first mark after the current position, in the order
+// of the book, wrapping around after the last one. Like the marks, the
+// position is the line ScrollOff lines below the top, so that the mark
+// jumped to isn't found again after it.
+func (b *Book) NextMark() {
+	if len(b.Marks) == 0 {
+		b.Flash("no marks set")
+		return
+	}
+
+	chapter, line := b.menuContext, -1
+	if b.Current != b.TOC.Index() {
+		chapter, line = b.Current, b.Chapters[b.Current].GetOffset()+b.ScrollOff
+	}
+
+	names := b.markNames()
+	sort.SliceStable(names, func(i, j int) bool {
+		mi, mj := b.Marks[names[i]], b.Marks[names[j]]
+		if mi.Chapter != mj.Chapter {
+			return mi.Chapter < mj.Chapter
+		}
+		return mi.Line < mj.Line
+	})
+
+	next := names[0]
+	for _, r := range names {
+		m := b.Marks[r]
+		if m.Chapter > chapter || m.Chapter == chapter && m.Line > line {
+			next = r
+			break
+		}
+	}
+	if m := b.Marks[next]; m.Chapter < chapter || m.Chapter == chapter && m.Line <= line {
+		b.Flash(fmt.Sprintf("wrapped around to mark %c", next))
+	} else {
+		b.Flash(fmt.Sprintf("mark %c", next))
+	}
+	b.JumpToMark(next)
+}
+
+// ShowMarks lists the marks with the text they point to, enter jumping to
+// the selected one and d deleting it.
+func (b *Book) ShowMarks() {
+	names := b.markNames()
+	if len(names) == 0 {
+		b.Flash("no marks set")
+		return
+	}
+
+	l := tview.NewList()
+	applyListTheme(l, b.Theme)
+	l.SetBorder(true)
+	l.SetTitle("Marks - d: delete")
+	for _, r := range names {
+		m := b.Marks[r]
+		r := r
+		l.AddItem(
+			tview.Escape(fmt.Sprintf("%c  %s, line %d", r, b.chapterTitle(m.Chapter), m.Line+1)),
+			tview.Escape(m.Preview),
+			0, func() {
+				b.HideOverlay()
+				b.JumpToMark(r)
+			},
+		)
+	}
+	l.SetDoneFunc(b.HideOverlay)
+	l.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() != tcell.KeyRune || event.Rune() != 'd' {
+			return event
+		}
+		i := l.GetCurrentItem()
+		delete(b.Marks, names[i])
+		names = append(names[:i], names[i+1:]...)
+		l.RemoveItem(i)
+		if len(names) == 0 {
+			b.HideOverlay()
+		}
+		return nil
+	})
+
+	b.ShowOverlay("marks", l, b.Width, 2*len(names)+2)
+}
+
+func (b Book) chapterTitle(idx int) string {
+	if idx < 0 || idx >= len(b.Chapters) {
+		return fmt.Sprintf("chapter %d", idx+1)
+	}
+
+	return b.Chapters[idx].title
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestNextMarkScrollOff(t *testing.T) {
+	b := newTestBook(nil, []TOCEntry{{Name: "One", URL: "one.xhtml"}})
+	b.Current = 0
+	b.ScrollOff = 3
+	b.Marks = map[rune]Mark{
+		'a': {Chapter: 0, Line: 10},
+		'b': {Chapter: 0, Line: 20},
+	}
+
+	for i, expected := range []int{10, 20, 10, 20} {
+		b.NextMark()
+		if line := b.Chapters[0].GetOffset() + b.ScrollOff; line != expected {
+			t.Errorf("NextMark #%d went to line %d, expected %d", i+1, line, expected)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/rivo/tview"
+)
+
+// Inline formatting is kept in the converted text as private use characters,
+// which are replaced by style tags when the text is displayed and stripped
+// for everything else (search, word counts, export).
+const (
+	emphasisStart = '\uE000'
+	emphasisEnd   = '\uE001'
+	strongStart   = '\uE002'
+	strongEnd     = '\uE003'
+)
+
+var emphasisElements = map[string]rune{
+	"em": emphasisStart, "i": emphasisStart, "cite": emphasisStart,
+	"strong": strongStart, "b": strongStart,
+}
+
+func isMarkup(r rune) bool {
+	return r >= emphasisStart && r <= strongEnd
+}
+
+// stripMarkup removes the inline formatting markers from text.
+func stripMarkup(text string) string {
+	if !strings.ContainsAny(text, string([]rune{emphasisStart, emphasisEnd, strongStart, strongEnd})) {
+		return text
+	}
+
+	return strings.Map(func(r rune) rune {
+		if isMarkup(r) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// textWidth returns the screen width of text, ignoring formatting markers.
+func textWidth(text string) int {
+	return tview.StringWidth(stripMarkup(text))
+}
+
+// renderLine escapes line for use in a dynamic-colors TextView, turning its
+// formatting markers into style tags, emphasis being shown in the emphasis
+// color. The byte ranges in matches, which refer to the line stripped of its
+// markers, are wrapped in the given color tag.
+func renderLine(line string, matches [][2]int, color string, emphasis string) string {
+	var out, segment strings.Builder
+	flush := func() {
+		out.WriteString(tview.Escape(segment.String()))
+		segment.Reset()
+	}
+
+	offset, inMatch := 0, false
+	for _, r := range line {
+		if inMatch && offset == matches[0][1] {
+			flush()
+			out.WriteString("[-:-]")
+			matches = matches[1:]
+			inMatch = false
+		}
+		if !inMatch && len(matches) > 0 && offset == matches[0][0] {
+			flush()
+			out.WriteString(color)
+			inMatch = true
+		}
+
+		switch r {
+		case emphasisStart:
+			flush()
+			out.WriteString(emphasis)
+		case emphasisEnd:
+			flush()
+			out.WriteString("[-]")
+		case strongStart:
+			flush()
+			out.WriteString("[::b]")
+		case strongEnd:
+			flush()
+			out.WriteString("[::-]")
+		default:
+			segment.WriteRune(r)
+			offset += len(string(r))
+		}
+	}
+	flush()
+	if inMatch {
+		out.WriteString("[-:-]")
+	}
+
+	return out.String()
+}
+
+// emphasisTag returns the style tag emphasized text is shown with.
+func emphasisTag(theme Theme) string {
+	return fmt.Sprintf("[#%06x]", theme.Accent.Hex())
+}
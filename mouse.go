@@ -0,0 +1,205 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/gdamore/tcell"
+)
+
+// MouseScrollLines is the number of lines scrolled by each step of the mouse
+// wheel.
+const MouseScrollLines = 3
+
+// mouseScreen is the screen of the application when the mouse is enabled.
+// The tview version lectern depends on doesn't handle the mouse, so the mouse
+// events are taken out of the screen's events and passed to handle, the
+// other events going through to the application.
+type mouseScreen struct {
+	tcell.Screen
+	handle func(*tcell.EventMouse)
+
+	mu sync.Mutex
+	// resumed is closed when the screen is resumed, nil when it isn't
+	// suspended.
+	resumed chan struct{}
+}
+
+func newMouseScreen(handle func(*tcell.EventMouse)) (*mouseScreen, error) {
+	screen, err := tcell.NewScreen()
+	if err != nil {
+		return nil, err
+	}
+
+	return &mouseScreen{
+		Screen: screen,
+		handle: handle,
+	}, nil
+}
+
+func (s *mouseScreen) Init() error {
+	err := s.Screen.Init()
+	if err != nil {
+		return err
+	}
+	s.Screen.EnableMouse()
+
+	return nil
+}
+
+// PollEvent returns the next event of the screen which isn't a mouse event,
+// waiting for the screen to be resumed while it is suspended.
+func (s *mouseScreen) PollEvent() tcell.Event {
+	for {
+		s.mu.Lock()
+		screen, resumed := s.Screen, s.resumed
+		s.mu.Unlock()
+		if resumed != nil {
+			<-resumed
+			continue
+		}
+
+		switch event := screen.PollEvent().(type) {
+		case *tcell.EventMouse:
+			s.handle(event)
+		case nil:
+			// the screen was finalized, by Suspend or by the
+			// application stopping
+			s.mu.Lock()
+			suspended := s.resumed != nil || s.Screen != screen
+			s.mu.Unlock()
+			if !suspended {
+				return nil
+			}
+		default:
+			return event
+		}
+	}
+}
+
+// Suspend finalizes the screen, calls f and initializes a new screen in its
+// place, like tview's Application.Suspend which would replace it with a
+// screen ignoring the mouse.
+func (s *mouseScreen) Suspend(f func()) error {
+	resumed := make(chan struct{})
+	s.mu.Lock()
+	s.resumed = resumed
+	old := s.Screen
+	s.mu.Unlock()
+	defer close(resumed)
+
+	old.Fini()
+	f()
+
+	screen, err := tcell.NewScreen()
+	if err == nil {
+		err = screen.Init()
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.resumed = nil
+	if err != nil {
+		return err
+	}
+	screen.EnableMouse()
+	s.Screen = screen
+
+	return nil
+}
+
+// handleMouse handles the mouse events of the screen. The wheel scrolls the
+// current chapter and clicking the progress bar seeks within it. In the
+// table of contents, the wheel moves the selection and clicking an entry
+// opens it. Mouse events are ignored while an overlay is shown.
+func (b *Book) handleMouse(event *tcell.EventMouse) {
+	buttons := event.Buttons()
+	click := buttons&tcell.Button1 != 0 && b.mouseButtons&tcell.Button1 == 0
+	b.mouseButtons = buttons
+	if b.overlay != "" {
+		return
+	}
+
+	x, y := event.Position()
+	if !b.FocusMode && inRect(b.progress.GetRect, x, y) {
+		if click {
+			b.seekProgress(x)
+		}
+		return
+	}
+
+	up, down := buttons&tcell.WheelUp != 0, buttons&tcell.WheelDown != 0
+	if b.Current == b.TOC.Index() {
+		for i := 0; i < MouseScrollLines; i++ {
+			if up {
+				b.MenuUp()
+			}
+			if down {
+				b.MenuDown()
+			}
+		}
+		if i, ok := b.TOC.itemAt(x, y); ok && click {
+			b.TOC.l.SetCurrentItem(i)
+			b.TOC.cb(b.TOC.indices[i])
+		}
+		return
+	}
+
+	switch {
+	case up:
+		b.ScrollBy(-MouseScrollLines)
+	case down:
+		b.ScrollBy(MouseScrollLines)
+	}
+}
+
+// inRect reports whether the cell at x, y is within the rectangle returned
+// by rect.
+func inRect(rect func() (int, int, int, int), x, y int) bool {
+	rx, ry, width, height := rect()
+
+	return x >= rx && x < rx+width && y >= ry && y < ry+height
+}
+
+// itemAt returns the index of the list item drawn at x, y. Like the list
+// does when drawing, the items take two lines with their secondary text and
+// the selected item is kept in the lower half of the list.
+func (t *TOC) itemAt(x, y int) (int, bool) {
+	if !inRect(t.l.GetInnerRect, x, y) {
+		return -1, false
+	}
+	_, top, _, height := t.l.GetInnerRect()
+
+	offset := 0
+	if current := t.l.GetCurrentItem(); current >= height/2 {
+		offset = current + 1 - height/2
+	}
+	i := offset + (y-top)/2
+	if i >= len(t.indices) {
+		return -1, false
+	}
+
+	return i, true
+}
+
+// seekProgress scrolls the current chapter to the fraction of its length
+// matching the column x of the progress bar's gauge.
+func (b *Book) seekProgress(x int) {
+	if b.Current == b.TOC.Index() || b.preloading {
+		return
+	}
+	f, ok := b.progressFraction()
+	if !ok {
+		return
+	}
+	px, _, width, _ := b.progress.GetRect()
+	n := gaugeWidth(f, width)
+	if n < 2 {
+		return
+	}
+
+	seek := float64(x-px-1) / float64(n-1)
+	if seek < 0 || seek > 1 {
+		// outside the gauge, on its brackets or percentage
+		return
+	}
+	b.Chapters[b.Current].SetFraction(seek)
+}
@@ -0,0 +1,299 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// navHref returns the path of the EPUB3 navigation document, relative to the
+// package document like the spine URLs, or an empty string if the book has
+// none. epubgo only reads the NCX, so the package document is read from the
+// archive directly.
+func (b *EBook) navHref() (string, error) {
+	z, err := zip.OpenReader(b.fname)
+	if err != nil {
+		return "", err
+	}
+	defer z.Close()
+
+	opf, err := packagePath(&z.Reader)
+	if err != nil {
+		return "", err
+	}
+	var pkg struct {
+		Items []struct {
+			Href       string `xml:"href,attr"`
+			Properties string `xml:"properties,attr"`
+		} `xml:"manifest>item"`
+	}
+	err = readZipXML(&z.Reader, opf, &pkg)
+	if err != nil {
+		return "", err
+	}
+	for _, item := range pkg.Items {
+		for _, property := range strings.Fields(item.Properties) {
+			if property == "nav" {
+				return item.Href, nil
+			}
+		}
+	}
+
+	return "", nil
+}
+
+// packagePath returns the path of the package document in the archive, as
+// listed in its container file.
+func packagePath(z *zip.Reader) (string, error) {
+	var container struct {
+		Rootfiles []struct {
+			FullPath string `xml:"full-path,attr"`
+		} `xml:"rootfiles>rootfile"`
+	}
+	err := readZipXML(z, "META-INF/container.xml", &container)
+	if err != nil {
+		return "", err
+	}
+	if len(container.Rootfiles) == 0 {
+		return "", fmt.Errorf("no package document")
+	}
+
+	return container.Rootfiles[0].FullPath, nil
+}
+
+func readZipXML(z *zip.Reader, name string, v interface{}) error {
+	for _, f := range z.File {
+		if f.Name != name {
+			continue
+		}
+		r, err := f.Open()
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		return xml.NewDecoder(r).Decode(v)
+	}
+
+	return fmt.Errorf("%s: not found", name)
+}
+
+// navDocumentTOC reads the table of contents from the EPUB3 navigation
+// document, nil if the book has none. Nested entries are listed after their
+// parent.
+func (b *EBook) navDocumentTOC() ([]TOCEntry, error) {
+	href, err := b.navHref()
+	if err != nil || href == "" {
+		return nil, err
+	}
+
+	r, err := b.OpenFile(href)
+	if err != nil {
+		return nil, err
+	}
+	buf, err := ioutil.ReadAll(r)
+	r.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return navTOC(href, buf)
+}
+
+// navTOC reads the table of contents from the navigation document buf, at
+// href, nil if it has none. Nested entries are listed after their parent.
+func navTOC(href string, buf []byte) ([]TOCEntry, error) {
+	doc, err := html.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+
+	nav := findTOCNav(doc)
+	if nav == nil {
+		return nil, nil
+	}
+
+	toc := []TOCEntry{}
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.Data == "a" {
+			target, _ := attr(n, "href")
+			if u, ok := resolveLink(href, target); ok {
+				toc = append(toc, TOCEntry{
+					Name: textContent(n),
+					URL:  u,
+				})
+			}
+			return
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(nav)
+
+	return toc, nil
+}
+
+type ncxPoint struct {
+	Label   string `xml:"navLabel>text"`
+	Content struct {
+		Src string `xml:"src,attr"`
+	} `xml:"content"`
+	Points []ncxPoint `xml:"navPoint"`
+}
+
+// ncxTOC reads the table of contents from the NCX document buf, at href.
+// Nested entries are listed after their parent.
+func ncxTOC(href string, buf []byte) ([]TOCEntry, error) {
+	var ncx struct {
+		Points []ncxPoint `xml:"navMap>navPoint"`
+	}
+	err := xml.Unmarshal(buf, &ncx)
+	if err != nil {
+		return nil, err
+	}
+
+	toc := []TOCEntry{}
+	var walk func([]ncxPoint)
+	walk = func(points []ncxPoint) {
+		for _, p := range points {
+			if u, ok := resolveLink(href, p.Content.Src); ok {
+				toc = append(toc, TOCEntry{
+					Name: strings.TrimSpace(p.Label),
+					URL:  u,
+				})
+			}
+			walk(p.Points)
+		}
+	}
+	walk(ncx.Points)
+
+	return toc, nil
+}
+
+// findTOCNav returns the nav element of type toc, or the first nav element
+// if none has a type.
+func findTOCNav(n *html.Node) *html.Node {
+	var first *html.Node
+	var walk func(*html.Node) *html.Node
+	walk = func(n *html.Node) *html.Node {
+		if n.Type == html.ElementNode && n.Data == "nav" {
+			if t, _ := attr(n, "epub:type"); strings.Contains(" "+t+" ", " toc ") {
+				return n
+			}
+			if first == nil {
+				first = n
+			}
+		}
+		for child := n.FirstChild; child != nil; child = child.NextSibling {
+			if found := walk(child); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	if nav := walk(n); nav != nil {
+		return nav
+	}
+
+	return first
+}
+
+// mergeSpine adds the spine items toc doesn't refer to, each before the first
+// entry referring to a later spine item, so that no part of the book is left
+// out of the table of contents.
+func (b *EBook) mergeSpine(toc []TOCEntry) []TOCEntry {
+	return mergeReadingOrder(toc, b.spineURLs, b.spineEntry)
+}
+
+// mergeReadingOrder adds the documents at urls, in reading order, that toc
+// doesn't refer to, each before the first entry referring to a later
+// document, their entries being returned by entry.
+func mergeReadingOrder(toc []TOCEntry, urls []string, entry func(int, string) TOCEntry) []TOCEntry {
+	position := map[string]int{}
+	for i, u := range urls {
+		position[u] = i
+	}
+	listed := map[string]bool{}
+	for _, entry := range toc {
+		listed[chapterPath(entry.URL)] = true
+	}
+
+	for i, u := range urls {
+		if listed[u] {
+			continue
+		}
+
+		at := len(toc)
+		for j, entry := range toc {
+			if p, ok := position[chapterPath(entry.URL)]; ok && p > i {
+				at = j
+				break
+			}
+		}
+		toc = append(toc, TOCEntry{})
+		copy(toc[at+1:], toc[at:])
+		toc[at] = entry(i, u)
+	}
+
+	return toc
+}
+
+// nonLinearItems returns the URLs of the spine items marked linear="no",
+// relative to the package document like the spine URLs. epubgo doesn't
+// expose the attribute, so the package document is read from the archive
+// directly.
+func nonLinearItems(fname string) (map[string]bool, error) {
+	z, err := zip.OpenReader(fname)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+
+	opf, err := packagePath(&z.Reader)
+	if err != nil {
+		return nil, err
+	}
+	var pkg struct {
+		Items []struct {
+			ID   string `xml:"id,attr"`
+			Href string `xml:"href,attr"`
+		} `xml:"manifest>item"`
+		ItemRefs []struct {
+			IDRef  string `xml:"idref,attr"`
+			Linear string `xml:"linear,attr"`
+		} `xml:"spine>itemref"`
+	}
+	err = readZipXML(&z.Reader, opf, &pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	hrefs := map[string]string{}
+	for _, item := range pkg.Items {
+		hrefs[item.ID] = item.Href
+	}
+	nonLinear := map[string]bool{}
+	for _, ref := range pkg.ItemRefs {
+		if strings.TrimSpace(ref.Linear) == "no" && hrefs[ref.IDRef] != "" {
+			nonLinear[hrefs[ref.IDRef]] = true
+		}
+	}
+
+	return nonLinear, nil
+}
+
+// markNonLinear marks the entries of toc leading to non-linear spine items.
+func (b *EBook) markNonLinear(toc []TOCEntry) []TOCEntry {
+	for i, entry := range toc {
+		toc[i].NonLinear = b.nonLinear[chapterPath(entry.URL)]
+	}
+
+	return toc
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+const navOPF = `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="3.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Navigation</dc:title>
+    <dc:identifier id="id">navigation</dc:identifier>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="nav" href="nav.xhtml" media-type="application/xhtml+xml" properties="nav"/>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="one" href="one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="notes" href="notes.xhtml" media-type="application/xhtml+xml"/>
+    <item id="two" href="two.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="one"/>
+    <itemref idref="notes" linear="no"/>
+    <itemref idref="two"/>
+  </spine>
+</package>`
+
+func TestEBookTOCNav(t *testing.T) {
+	dir, cleanup := tempStateDir(t)
+	defer cleanup()
+	fname := writeEPUB(t, dir, map[string]string{
+		"content.opf": navOPF,
+		"nav.xhtml": xhtml("Contents", `<nav epub:type="toc"><ol>
+  <li><a href="one.xhtml">Nav one</a></li>
+  <li><a href="two.xhtml">Nav two</a></li>
+</ol></nav>`),
+		"toc.ncx": `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <navMap>
+    <navPoint id="p1" playOrder="1"><navLabel><text>NCX one</text></navLabel><content src="one.xhtml"/></navPoint>
+    <navPoint id="p2" playOrder="2"><navLabel><text>NCX two</text></navLabel><content src="two.xhtml"/></navPoint>
+  </navMap>
+</ncx>`,
+		"one.xhtml":   xhtml("One", `<h1>One</h1><p>First.</p>`),
+		"notes.xhtml": xhtml("Notes", `<h1>Notes</h1><p>Aside.</p>`),
+		"two.xhtml":   xhtml("Two", `<h1>Two</h1><p>Second.</p>`),
+	})
+
+	ebook, err := NewEBook(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ebook.Close()
+	toc, err := ebook.TOC()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the navigation document is preferred to the NCX, and the notes it
+	// doesn't list are added in reading order
+	expected := []TOCEntry{
+		{Name: "Nav one", URL: "one.xhtml"},
+		{Name: "Notes", URL: "notes.xhtml", NonLinear: true},
+		{Name: "Nav two", URL: "two.xhtml"},
+	}
+	if !reflect.DeepEqual(toc, expected) {
+		t.Errorf("TOC() = %+v, expected %+v", toc, expected)
+	}
+	if ebook.FallbackTOC {
+		t.Error("FallbackTOC set with a navigation document")
+	}
+}
+
+func TestEBookTOCFallback(t *testing.T) {
+	dir, cleanup := tempStateDir(t)
+	defer cleanup()
+	fname := writeEPUB(t, dir, map[string]string{
+		"content.opf": `<?xml version="1.0"?>
+<package xmlns="http://www.idpf.org/2007/opf" version="2.0" unique-identifier="id">
+  <metadata xmlns:dc="http://purl.org/dc/elements/1.1/">
+    <dc:title>Fallback</dc:title>
+    <dc:identifier id="id">fallback</dc:identifier>
+    <dc:language>en</dc:language>
+  </metadata>
+  <manifest>
+    <item id="ncx" href="toc.ncx" media-type="application/x-dtbncx+xml"/>
+    <item id="one" href="one.xhtml" media-type="application/xhtml+xml"/>
+    <item id="two" href="two.xhtml" media-type="application/xhtml+xml"/>
+  </manifest>
+  <spine toc="ncx">
+    <itemref idref="one"/>
+    <itemref idref="two"/>
+  </spine>
+</package>`,
+		"toc.ncx": `<?xml version="1.0"?>
+<ncx xmlns="http://www.daisy.org/z3986/2005/ncx/" version="2005-1">
+  <navMap/>
+</ncx>`,
+		"one.xhtml": xhtml("One", `<h1>The first chapter</h1><p>First.</p>`),
+		"two.xhtml": xhtml("", `<p>Second.</p>`),
+	})
+
+	ebook, err := NewEBook(fname)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ebook.Close()
+	toc, err := ebook.TOC()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []TOCEntry{
+		{Name: "The first chapter", URL: "one.xhtml"},
+		{Name: "Chapter 2", URL: "two.xhtml"},
+	}
+	if !reflect.DeepEqual(toc, expected) {
+		t.Errorf("TOC() = %+v, expected %+v", toc, expected)
+	}
+	if !ebook.FallbackTOC {
+		t.Fatal("FallbackTOC not set")
+	}
+
+	b := newTestBook(ebook, toc)
+	b.flashFallbackTOC()
+	if b.message == "" {
+		t.Error("no message flashed for the fallback table of contents")
+	}
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// Note is a text attached to a position in the book.
+type Note struct {
+	Chapter int
+	// Line and SourceLine are the line as shown and the line of the
+	// chapter's text, like for marks.
+	Line       int
+	SourceLine int
+	Text       string
+	// Preview is the start of the text at the note's position when it was
+	// added, or the text selected in visual mode.
+	Preview string
+	// Time is when the note was added.
+	Time time.Time
+}
+
+// ShowAddNote asks for the text of a note to attach to the current position.
+func (b *Book) ShowAddNote() {
+	if b.Current == b.TOC.Index() {
+		b.Flash("open a chapter to add a note")
+		return
+	}
+
+	c := b.Chapters[b.Current]
+	line := c.GetOffset() + b.ScrollOff
+	b.showAddNote(line, c.lineText(line))
+}
+
+// showAddNote asks for the text of a note to attach to the line of the
+// current chapter, preview being the text it annotates.
+func (b *Book) showAddNote(line int, preview string) {
+	input := tview.NewInputField()
+	applyInputTheme(input, b.Theme)
+	input.SetLabel("Note: ")
+	input.SetBorder(true)
+	input.SetDoneFunc(func(key tcell.Key) {
+		b.HideOverlay()
+		if key != tcell.KeyEnter {
+			return
+		}
+		b.AddNote(line, preview, input.GetText())
+	})
+
+	b.ShowOverlay("note", input, b.Width, 3)
+}
+
+// AddNote attaches text to the line of the current chapter, like a mark.
+func (b *Book) AddNote(line int, preview, text string) {
+	text = strings.TrimSpace(text)
+	if text == "" || b.Current == b.TOC.Index() {
+		return
+	}
+
+	b.Notes = append(b.Notes, Note{
+		Chapter:    b.Current,
+		Line:       line,
+		SourceLine: b.Chapters[b.Current].sourceLine(line),
+		Text:       text,
+		Preview:    preview,
+		Time:       time.Now(),
+	})
+	sortNotes(b.Notes)
+	b.Flash("note added")
+}
+
+// sortNotes sorts notes in the order of the book.
+func sortNotes(notes []Note) {
+	sort.SliceStable(notes, func(i, j int) bool {
+		if notes[i].Chapter != notes[j].Chapter {
+			return notes[i].Chapter < notes[j].Chapter
+		}
+		if notes[i].SourceLine >= 0 && notes[j].SourceLine >= 0 && notes[i].SourceLine != notes[j].SourceLine {
+			return notes[i].SourceLine < notes[j].SourceLine
+		}
+		return notes[i].Line < notes[j].Line
+	})
+}
+
+// ShowNotes lists the notes in the order of the book, enter jumping to the
+// selected one and d deleting it.
+func (b *Book) ShowNotes() {
+	if len(b.Notes) == 0 {
+		b.Flash("no notes")
+		return
+	}
+
+	l := tview.NewList()
+	applyListTheme(l, b.Theme)
+	l.SetBorder(true)
+	l.SetTitle("Notes - d: delete")
+	for _, n := range b.Notes {
+		n := n
+		l.AddItem(
+			tview.Escape(n.Text),
+			tview.Escape(fmt.Sprintf("%s, line %d", b.chapterTitle(n.Chapter), n.Line+1)),
+			0, func() {
+				b.HideOverlay()
+				b.JumpToNote(n)
+			},
+		)
+	}
+	l.SetDoneFunc(b.HideOverlay)
+	l.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		if event.Key() != tcell.KeyRune || event.Rune() != 'd' {
+			return event
+		}
+		i := l.GetCurrentItem()
+		b.Notes = append(b.Notes[:i], b.Notes[i+1:]...)
+		l.RemoveItem(i)
+		if len(b.Notes) == 0 {
+			b.HideOverlay()
+		}
+		return nil
+	})
+
+	b.ShowOverlay("notes", l, b.Width, 2*len(b.Notes)+2)
+}
+
+func (b *Book) JumpToNote(n Note) {
+	if n.Chapter < 0 || n.Chapter >= len(b.Chapters) {
+		return
+	}
+
+	b.recordJump()
+	b.Chapters[n.Chapter].scrollToPosition(n.Line, n.SourceLine, b.ScrollOff)
+	if b.Current != n.Chapter {
+		b.GoToPage(n.Chapter)
+	}
+}
+
+// visibleNotes returns the number of notes attached to the lines first to
+// last of the chapter idx.
+func (b Book) visibleNotes(idx, first, last int) int {
+	count := 0
+	for _, n := range b.Notes {
+		if n.Chapter == idx && n.Line >= first && n.Line <= last {
+			count++
+		}
+	}
+
+	return count
+}
+
+// notesStatus returns the part of the status bar telling the notes attached
+// to the lines first to last of the chapter idx.
+func (b Book) notesStatus(idx, first, last int) string {
+	switch n := b.visibleNotes(idx, first, last); n {
+	case 0:
+		return ""
+	case 1:
+		return " - 1 note"
+	default:
+		return fmt.Sprintf(" - %d notes", n)
+	}
+}
+
+// printNotes prints the notes of each book that has some, along with the
+// chapter and line they are attached to.
+func printNotes(w io.Writer, fnames []string) error {
+	first := true
+	for _, fname := range fnames {
+		state, _, err := LoadState(fname)
+		if err != nil {
+			return fmt.Errorf("%s: reading the state file: %s", stateFname(fname), err)
+		}
+		if len(state.Notes) == 0 {
+			continue
+		}
+
+		ebook, err := openBook(fname)
+		if err != nil {
+			return err
+		}
+		toc, err := ebook.TOC()
+		ebook.Close()
+		if err != nil {
+			return fmt.Errorf("%s: reading table of contents: %s", fname, err)
+		}
+
+		if !first {
+			fmt.Fprintln(w)
+		}
+		first = false
+		fmt.Fprintf(w, "%s\n%s\n", fname, strings.Repeat("=", tview.StringWidth(fname)))
+		for _, n := range state.Notes {
+			chapter := fmt.Sprintf("chapter %d", n.Chapter+1)
+			if n.Chapter >= 0 && n.Chapter < len(toc) {
+				chapter += ", " + toc[n.Chapter].Name
+			}
+			_, err = fmt.Fprintf(w, "\n%s, line %d:\n%s\n", chapter, n.Line+1, n.Text)
+			if err != nil {
+				return err
+			}
+			if n.Preview != "" {
+				fmt.Fprintf(w, "> %s\n", n.Preview)
+			}
+		}
+	}
+
+	return nil
+}
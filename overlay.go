@@ -0,0 +1,44 @@
+package main
+
+import (
+	"github.com/rivo/tview"
+)
+
+func (b *Book) ShowOverlay(name string, p tview.Primitive, width, height int) {
+	if b.overlay != "" {
+		b.HideOverlay()
+	}
+
+	g := tview.NewGrid()
+	g.SetColumns(-1, width, -1)
+	g.SetRows(-1, height, -1)
+	g.SetBackgroundColor(b.Theme.Background)
+
+	g.Clear()
+	g.AddItem(p, 1, 1, 1, 1, 0, 0, true)
+
+	b.overlay = name
+	b.tPages.AddPage(name, g, true, true)
+	b.app.SetFocus(p)
+}
+
+func (b *Book) HideOverlay() {
+	if b.overlay == "" {
+		return
+	}
+
+	b.tPages.RemovePage(b.overlay)
+	b.overlay = ""
+	b.app.SetFocus(b.tPages)
+}
+
+func newOverlayText(theme Theme, title, text string) *tview.TextView {
+	t := tview.NewTextView()
+	t.SetBackgroundColor(theme.Background)
+	t.SetTextColor(theme.Foreground)
+	t.SetBorder(true)
+	t.SetTitle(title)
+	t.SetText(text)
+
+	return t
+}
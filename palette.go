@@ -0,0 +1,228 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+// Command is an action of the command palette, taking the rest of the line
+// typed after its name.
+type Command struct {
+	Name string
+	Run  func(args string) error
+}
+
+// Commands lists the commands of the palette: the ones taking arguments,
+// followed by every key binding's action under its name.
+func (b *Book) Commands() []Command {
+	commands := []Command{
+		{Name: "goto", Run: b.gotoCommand},
+		{Name: "search", Run: func(args string) error {
+			b.Search(args, false)
+			return nil
+		}},
+		{Name: "width", Run: b.widthCommand},
+		{Name: "spacing", Run: b.spacingCommand},
+		{Name: "theme", Run: b.themeCommand},
+		{Name: "export", Run: b.exportCommand},
+	}
+	for _, binding := range b.Bindings() {
+		if binding.Name == "command" {
+			continue
+		}
+		action := binding.Action
+		commands = append(commands, Command{
+			Name: binding.Name,
+			Run: func(string) error {
+				action()
+				return nil
+			},
+		})
+	}
+
+	return commands
+}
+
+// ShowCommand opens the command palette, where the name of a command can be
+// completed with tab.
+func (b *Book) ShowCommand() {
+	input := tview.NewInputField()
+	applyInputTheme(input, b.Theme)
+	input.SetLabel(":")
+	input.SetBorder(true)
+	input.SetTitle("Tab: complete the command name")
+	input.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyTab:
+			input.SetText(b.completeCommand(input.GetText()))
+		case tcell.KeyEnter:
+			b.HideOverlay()
+			b.RunCommand(input.GetText())
+		default:
+			b.HideOverlay()
+		}
+	})
+
+	b.ShowOverlay("command", input, b.Width, 3)
+}
+
+// RunCommand parses and runs a command line, reporting errors in the status
+// bar.
+func (b *Book) RunCommand(line string) {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return
+	}
+	name, args := line, ""
+	if i := strings.IndexFunc(line, func(r rune) bool { return r == ' ' || r == '\t' }); i != -1 {
+		name, args = line[:i], strings.TrimSpace(line[i:])
+	}
+
+	for _, command := range b.Commands() {
+		if command.Name != name {
+			continue
+		}
+		err := command.Run(args)
+		if err != nil {
+			b.Flash(fmt.Sprintf("%s: %s", name, err))
+		}
+		return
+	}
+
+	b.Flash(fmt.Sprintf("unknown command %q", name))
+}
+
+// completeCommand completes the command name at the start of line, as far as
+// the matching names share a prefix. The candidates are listed in the status
+// bar when there are several.
+func (b *Book) completeCommand(line string) string {
+	if strings.ContainsAny(line, " \t") {
+		return line
+	}
+
+	var names []string
+	for _, command := range b.Commands() {
+		if strings.HasPrefix(command.Name, line) {
+			names = append(names, command.Name)
+		}
+	}
+	switch len(names) {
+	case 0:
+		return line
+	case 1:
+		return names[0] + " "
+	}
+
+	sort.Strings(names)
+	b.Flash(strings.Join(names, " "))
+	prefix := names[0]
+	for _, name := range names[1:] {
+		for !strings.HasPrefix(name, prefix) {
+			prefix = prefix[:len(prefix)-1]
+		}
+	}
+
+	return prefix
+}
+
+func (b *Book) gotoCommand(args string) error {
+	if args == "" {
+		return fmt.Errorf("expected a chapter number")
+	}
+	b.GoToChapterNumber(args)
+
+	return nil
+}
+
+func (b *Book) widthCommand(args string) error {
+	w, err := strconv.Atoi(args)
+	if err != nil || w < MinWidth {
+		return fmt.Errorf("invalid width %q: must be a number of at least %d", args, MinWidth)
+	}
+	b.SetWidth(w)
+
+	return nil
+}
+
+func (b *Book) spacingCommand(args string) error {
+	n, err := strconv.Atoi(args)
+	if err != nil || n < 0 || n > MaxSpacing {
+		return fmt.Errorf("invalid spacing %q: must be between 0 and %d", args, MaxSpacing)
+	}
+	b.SetSpacing(n)
+
+	return nil
+}
+
+// themeCommand switches to the theme with the given name, "night" and "day"
+// turning night mode on and off.
+func (b *Book) themeCommand(args string) error {
+	switch args {
+	case "night":
+		b.SetNight(true)
+		return nil
+	case "day":
+		b.SetNight(false)
+		return nil
+	}
+
+	names := make([]string, 0, len(Themes))
+	for _, theme := range Themes {
+		if theme.Name == args {
+			b.SetTheme(theme)
+			return nil
+		}
+		names = append(names, theme.Name)
+	}
+
+	return fmt.Errorf("unknown theme %q, expected one of %s, night or day", args, strings.Join(names, ", "))
+}
+
+// exportFname returns the file the book at fname is exported to by default:
+// the book with the .txt extension, next to the directory for a directory of
+// HTML files.
+func exportFname(fname string, dir bool) string {
+	fname = filepath.Clean(fname)
+	if dir {
+		return fname + ".txt"
+	}
+
+	return strings.TrimSuffix(fname, filepath.Ext(fname)) + ".txt"
+}
+
+// exportCommand writes the text of the book to the given file, or to a .txt
+// file next to the book.
+func (b *Book) exportCommand(args string) error {
+	fname := args
+	if fname == "" {
+		_, dir := b.ebook.(*Directory)
+		fname = exportFname(b.fname, dir)
+	}
+	if fname == b.fname {
+		return fmt.Errorf("%s: refusing to overwrite the book", fname)
+	}
+
+	f, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	err = exportBook(f, b.fname, "", b.Width)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	b.Flash("exported to " + fname)
+
+	return nil
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestExportFname(t *testing.T) {
+	for _, test := range []struct {
+		fname    string
+		dir      bool
+		expected string
+	}{
+		{"book.epub", false, "book.txt"},
+		{"books/book.epub", false, filepath.Join("books", "book.txt")},
+		{"./book-dir/", true, "book-dir.txt"},
+		{"books/book.d", true, filepath.Join("books", "book.d.txt")},
+	} {
+		if actual := exportFname(test.fname, test.dir); actual != test.expected {
+			t.Errorf("exportFname(%q, %t) = %q, expected %q", test.fname, test.dir, actual, test.expected)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+)
+
+// peekDuration is how long PeekTOC shows the table of contents.
+const peekDuration = 2 * time.Second
+
+// peek is the position PeekTOC returns to.
+type peek struct {
+	chapter int
+	offset  int
+}
+
+// PeekTOC shows the table of contents for a moment, then returns to the exact
+// position it was opened from. Typing the key again returns at once, and
+// opening a chapter from the table of contents cancels the return.
+func (b *Book) PeekTOC() {
+	if b.Current == b.TOC.Index() {
+		b.endPeek(b.peeking)
+		return
+	}
+
+	p := &peek{
+		chapter: b.Current,
+		offset:  b.Chapters[b.Current].GetOffset(),
+	}
+	b.peeking = p
+	b.menuContext = b.Current
+	b.GoToPage(b.TOC.Index())
+
+	time.AfterFunc(peekDuration, func() {
+		b.app.QueueUpdateDraw(func() {
+			b.endPeek(p)
+		})
+	})
+}
+
+// endPeek returns to the position p was opened from, unless the peek is
+// over or the table of contents was left meanwhile.
+func (b *Book) endPeek(p *peek) {
+	if p == nil || b.peeking != p {
+		return
+	}
+	b.peeking = nil
+	if b.Current != b.TOC.Index() || b.overlay != "" {
+		return
+	}
+
+	b.GoToPage(p.chapter)
+	b.Chapters[p.chapter].SetOffset(p.offset)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// The values of Config.Progress, choosing what the progress bar measures.
+const (
+	ProgressBook    = "book"
+	ProgressChapter = "chapter"
+)
+
+// progressFraction returns the fraction shown by the progress bar, reporting
+// false when there is nothing to show.
+func (b Book) progressFraction() (float64, bool) {
+	if b.ProgressMode != ProgressChapter {
+		return b.Progress(), true
+	}
+	if b.Current == b.TOC.Index() {
+		return 0, false
+	}
+
+	c := b.Chapters[b.Current]
+	if !c.loaded {
+		return 0, false
+	}
+	n, err := c.t.NLines()
+	if err != nil || n == 0 {
+		return 0, false
+	}
+	line := c.GetOffset()
+	if line+b.PageHeight() >= n {
+		// the end of the chapter is visible
+		return 1, true
+	}
+
+	return float64(line) / float64(n), true
+}
+
+// progressBar renders f as a gauge followed by its percentage, fitting in
+// width columns.
+func progressBar(f float64, width int) string {
+	if f < 0 {
+		f = 0
+	}
+	if f > 1 {
+		f = 1
+	}
+	percent := fmt.Sprintf(" %.0f%%", 100*f)
+	n := gaugeWidth(f, width)
+	if n < 1 {
+		return strings.TrimSpace(percent)
+	}
+	done := int(f * float64(n))
+
+	return "[" + strings.Repeat("#", done) + strings.Repeat("-", n-done) + "]" + percent
+}
+
+// gaugeWidth returns the number of columns between the brackets of the gauge
+// rendered by progressBar, which starts at the first column.
+func gaugeWidth(f float64, width int) int {
+	return width - len(fmt.Sprintf(" %.0f%%", 100*f)) - 2
+}
+
+// progressText returns the content of the progress bar, scaled to its
+// current width. While chapters are preloaded, it shows how many were
+// loaded instead.
+func (b *Book) progressText() string {
+	_, _, width, _ := b.progress.GetRect()
+
+	if b.preloading {
+		loaded := 0
+		for _, c := range b.Chapters {
+			if c.loaded {
+				loaded++
+			}
+		}
+		if loaded < len(b.Chapters) {
+			label := fmt.Sprintf("Loading chapters %d/%d ", loaded, len(b.Chapters))
+			return label + progressBar(float64(loaded)/float64(len(b.Chapters)), width-utf8.RuneCountInString(label))
+		}
+		b.preloading = false
+	}
+
+	f, ok := b.progressFraction()
+	if !ok {
+		return ""
+	}
+
+	return progressBar(f, width)
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"github.com/gdamore/tcell"
+)
+
+// Quit stops the reader, from the text or the table of contents only: keys
+// typed in an overlay, like the note, search or command inputs, never quit.
+// With ConfirmQuit set, the quit key has to be confirmed by typing y or the
+// quit key again.
+func (b *Book) Quit() {
+	if b.overlay != "" {
+		return
+	}
+	if !b.ConfirmQuit {
+		b.app.Stop()
+		return
+	}
+
+	b.message = "quit? (y/n)"
+	b.pending = func(event *tcell.EventKey) {
+		b.message = ""
+		if event.Key() != tcell.KeyRune {
+			return
+		}
+		if r := event.Rune(); r == 'y' || r == 'Y' || r == b.key("quit") {
+			b.app.Stop()
+		}
+	}
+}
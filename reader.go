@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// Reader is a book lectern can display, split into chapters addressed by
+// URL.
+type Reader interface {
+	Metadata(field string) ([]string, error)
+	TOC() ([]TOCEntry, error)
+	// ReadChapter and ReadContent must be safe for concurrent use.
+	ReadChapter(u string) (string, error)
+	ReadContent(u string) (Content, error)
+	// ReadFile returns the content of a file of the book, like an image, at
+	// a URL relative to the root of the book like the chapter URLs.
+	ReadFile(u string) ([]byte, error)
+	// Cover returns the cover image, nil if there is none.
+	Cover() (image.Image, error)
+	SaveCache() error
+	Close()
+}
+
+// NewBook opens fname according to its extension: plain text and HTML files
+// are read as a single chapter, directories as books of HTML files, anything
+// else as an EPUB.
+func NewBook(fname string) (Reader, error) {
+	if info, err := os.Stat(fname); err == nil && info.IsDir() {
+		return NewDirectory(fname)
+	}
+
+	switch strings.ToLower(filepath.Ext(fname)) {
+	case ".txt":
+		return NewTextFile(fname, false)
+	case ".html", ".htm", ".xhtml":
+		return NewTextFile(fname, true)
+	default:
+		return NewEBook(fname)
+	}
+}
+
+func bookTitle(r Reader) string {
+	title, err := r.Metadata("title")
+	if err != nil || len(title) == 0 {
+		return ""
+	}
+
+	return title[0]
+}
+
+// TextFile is a plain text or HTML file, read as a book with a single
+// chapter.
+type TextFile struct {
+	Title string
+
+	url     string
+	dir     string
+	content Content
+}
+
+func NewTextFile(fname string, isHTML bool) (*TextFile, error) {
+	buf, err := ioutil.ReadFile(fname)
+	if err != nil {
+		return nil, err
+	}
+
+	f := &TextFile{
+		Title: strings.TrimSuffix(filepath.Base(fname), filepath.Ext(fname)),
+		url:   filepath.Base(fname),
+		dir:   filepath.Dir(fname),
+	}
+	if !isHTML {
+		f.content = Content{Text: strings.Replace(string(buf), "\r\n", "\n", -1)}
+		f.content = applyTransforms(f.content, textTransforms)
+		return f, nil
+	}
+
+	f.content, err = convertHTML(f.url, buf)
+	if err != nil {
+		return nil, fmt.Errorf("not a valid HTML file: %s", err)
+	}
+	if title := htmlTitle(buf); title != "" {
+		f.Title = title
+	}
+
+	return f, nil
+}
+
+// htmlTitle returns the content of the title element of an HTML document.
+func htmlTitle(buf []byte) string {
+	doc, err := html.Parse(bytes.NewReader(buf))
+	if err != nil {
+		return ""
+	}
+	n := findElement(doc, "title")
+	if n == nil {
+		return ""
+	}
+
+	return textContent(n)
+}
+
+func (f *TextFile) Metadata(field string) ([]string, error) {
+	if field == "title" {
+		return []string{f.Title}, nil
+	}
+
+	return nil, fmt.Errorf("metadata %q not found", field)
+}
+
+func (f *TextFile) TOC() ([]TOCEntry, error) {
+	return []TOCEntry{{Name: f.Title, URL: f.url}}, nil
+}
+
+func (f *TextFile) ReadChapter(u string) (string, error) {
+	content, err := f.ReadContent(u)
+
+	return stripMarkup(content.Text), err
+}
+
+func (f *TextFile) ReadContent(u string) (Content, error) {
+	if chapterPath(u) != f.url {
+		return Content{}, fmt.Errorf("chapter %q not found", u)
+	}
+
+	return f.content, nil
+}
+
+// ReadFile reads the file at u relative to the directory of the text file,
+// like the images of an HTML file.
+func (f *TextFile) ReadFile(u string) ([]byte, error) {
+	return ioutil.ReadFile(filepath.Join(f.dir, filepath.FromSlash(chapterPath(u))))
+}
+
+// SaveCache does nothing, the file is converted each time it is opened.
+func (f *TextFile) SaveCache() error {
+	return nil
+}
+
+func (f *TextFile) Close() {}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultWPM is the reading speed, in words per minute, used for reading time
+// estimates unless configured otherwise.
+const DefaultWPM = 200
+
+func countWords(text string) int {
+	return len(strings.Fields(text))
+}
+
+// readingMinutes returns the time needed to read the given number of words,
+// rounded up to the minute.
+func readingMinutes(words, wpm int) int {
+	if wpm <= 0 {
+		wpm = DefaultWPM
+	}
+
+	return (words + wpm - 1) / wpm
+}
+
+func formatMinutes(minutes int) string {
+	if minutes < 60 {
+		return fmt.Sprintf("%d min", minutes)
+	}
+
+	return fmt.Sprintf("%dh%02d", minutes/60, minutes%60)
+}
+
+// ChapterMinutes returns the estimated reading time of the chapter idx, or -1
+// if it hasn't been loaded yet.
+func (b Book) ChapterMinutes(idx int) int {
+	c := b.Chapters[idx]
+	if !c.loaded {
+		return -1
+	}
+
+	return readingMinutes(c.words, b.WPM)
+}
+
+// BookMinutes returns the estimated reading time of the whole book. Chapters
+// that haven't been loaded yet are assumed to be as long as the average
+// loaded one.
+func (b Book) BookMinutes() int {
+	known, sum := 0, 0
+	for _, c := range b.Chapters {
+		if !c.loaded {
+			continue
+		}
+		known++
+		sum += c.words
+	}
+	if known == 0 {
+		return 0
+	}
+
+	return readingMinutes(sum*len(b.Chapters)/known, b.WPM)
+}
+
+// tocSecondary returns the secondary text of the chapter idx in the table of
+// contents, its reading time once known, after a marker telling whether it
+// was read.
+func (b Book) tocSecondary(idx int) string {
+	marker := "  "
+	if f, ok := b.Furthest[idx]; ok {
+		marker = "▸ "
+		if f >= 1 {
+			marker = "✓ "
+		}
+	}
+
+	minutes := b.ChapterMinutes(idx)
+	if minutes == -1 {
+		return marker + b.TOC.entries[idx].URL
+	}
+
+	return marker + "about " + formatMinutes(minutes)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// MaxRecents is the number of books kept in the recently opened list.
+const MaxRecents = 20
+
+// Recent is a book of the recently opened list, shared by all books.
+type Recent struct {
+	// Fname is the absolute path of the book.
+	Fname string
+	Title string
+	// Progress is the fraction of the book read when it was last closed.
+	Progress float64
+}
+
+func recentsFname() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "recents.json"), nil
+}
+
+// LoadRecents reads the recently opened books, most recent first, leaving
+// out the ones whose file no longer exists. A missing file isn't an error.
+func LoadRecents() ([]Recent, error) {
+	fname, err := recentsFname()
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(fname)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var recents []Recent
+	dec := json.NewDecoder(f)
+	err = dec.Decode(&recents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fname, err)
+	}
+
+	existing := recents[:0]
+	for _, r := range recents {
+		if _, err := os.Stat(r.Fname); err == nil {
+			existing = append(existing, r)
+		}
+	}
+
+	return existing, nil
+}
+
+// SaveRecents writes the recently opened books, creating the config
+// directory if needed.
+func SaveRecents(recents []Recent) error {
+	fname, err := recentsFname()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(fname), 0755)
+	if err != nil {
+		return err
+	}
+
+	return writeJSON(fname, recents)
+}
+
+// addRecent moves r to the front of recents, dropping the oldest books past
+// MaxRecents.
+func addRecent(recents []Recent, r Recent) []Recent {
+	updated := []Recent{r}
+	for _, other := range recents {
+		if other.Fname != r.Fname {
+			updated = append(updated, other)
+		}
+	}
+	if len(updated) > MaxRecents {
+		updated = updated[:MaxRecents]
+	}
+
+	return updated
+}
+
+// updateRecents records the book at fname as the most recently opened one.
+func updateRecents(fname, title string, progress float64) error {
+	abs, err := filepath.Abs(fname)
+	if err != nil {
+		return err
+	}
+	recents, err := LoadRecents()
+	if err != nil {
+		return err
+	}
+
+	return SaveRecents(addRecent(recents, Recent{
+		Fname:    abs,
+		Title:    title,
+		Progress: progress,
+	}))
+}
+
+// recentFnames returns the paths of the recently opened books.
+func recentFnames(recents []Recent) []string {
+	fnames := make([]string, 0, len(recents))
+	for _, r := range recents {
+		fnames = append(fnames, r.Fname)
+	}
+
+	return fnames
+}
+
+// printRecents writes the recently opened books to w, one per line with the
+// progress, title and path separated by tabs.
+func printRecents(w io.Writer) error {
+	recents, err := LoadRecents()
+	if err != nil {
+		return err
+	}
+
+	for _, r := range recents {
+		_, err = fmt.Fprintf(w, "%.0f%%\t%s\t%s\n", 100*r.Progress, r.Title, r.Fname)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"github.com/gdamore/tcell"
+)
+
+// drawScrollbar draws a scrollbar to the right of the chapter's text, as drawn
+// at x, y, width and height, its thumb showing the part of the chapter shown
+// and ticks in the accent color showing the chapter's marks and notes. It is
+// left out when there is no room for it beside the text.
+func (b *Book) drawScrollbar(screen tcell.Screen, c *Chapter, x, y, width, height int) {
+	if !b.Scrollbar || !c.loaded || height == 0 {
+		return
+	}
+	last := x + width - 1
+	if c.columns {
+		last += width + ColumnGap
+	}
+	// the two columns next to the text are left to the focus line markers
+	column := last + 3
+	if screenWidth, _ := screen.Size(); column >= screenWidth {
+		return
+	}
+	n, err := c.t.NLines()
+	if err != nil || n == 0 {
+		return
+	}
+	row := func(line int) int {
+		r := line * height / n
+		if r >= height {
+			r = height - 1
+		}
+		return r
+	}
+
+	style := tcell.StyleDefault.Background(b.Theme.Background).Foreground(b.Theme.Foreground)
+	top := row(c.GetOffset())
+	size := c.visibleLines() * height / n
+	if size < 1 {
+		size = 1
+	}
+	for r := 0; r < height; r++ {
+		bar := '│'
+		if r >= top && r < top+size {
+			bar = '┃'
+		}
+		screen.SetContent(column, y+r, bar, nil, style)
+	}
+
+	tick := style.Foreground(b.Theme.Accent)
+	for _, note := range b.Notes {
+		if note.Chapter == c.Index() {
+			screen.SetContent(column, y+row(note.Line), '•', nil, tick)
+		}
+	}
+	for _, m := range b.Marks {
+		if m.Chapter == c.Index() {
+			screen.SetContent(column, y+row(m.Line), '◆', nil, tick)
+		}
+	}
+}
+
+// ToggleScrollbar shows or hides the scrollbar beside the text.
+func (b *Book) ToggleScrollbar() {
+	b.Scrollbar = !b.Scrollbar
+}
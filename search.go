@@ -0,0 +1,318 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+type SearchMatch struct {
+	Chapter int
+	Line    int
+}
+
+type Search struct {
+	Query         string
+	CaseSensitive bool
+
+	Matches []SearchMatch
+	Current int
+	Err     error
+}
+
+func searchLabel(caseSensitive bool) string {
+	if caseSensitive {
+		return "Search (case sensitive): "
+	}
+
+	return "Search: "
+}
+
+func (b *Book) ShowSearch() {
+	caseSensitive := false
+	if b.search != nil {
+		caseSensitive = b.search.CaseSensitive
+	}
+
+	input := tview.NewInputField()
+	applyInputTheme(input, b.Theme)
+	input.SetLabel(searchLabel(caseSensitive))
+	input.SetBorder(true)
+	input.SetTitle("Tab: toggle case sensitivity")
+	input.SetDoneFunc(func(key tcell.Key) {
+		switch key {
+		case tcell.KeyTab:
+			caseSensitive = !caseSensitive
+			input.SetLabel(searchLabel(caseSensitive))
+		case tcell.KeyEnter:
+			b.HideOverlay()
+			b.Search(input.GetText(), caseSensitive)
+		default:
+			b.HideOverlay()
+		}
+	})
+
+	b.ShowOverlay("search", input, b.Width, 3)
+}
+
+// Search looks for query in the text of the chapters, then goes to the first
+// match from the current position. Chapters are read and searched in the
+// background, like Preload does, a later search superseding an earlier one
+// still running.
+func (b *Book) Search(query string, caseSensitive bool) {
+	previous := b.search
+	b.searches++
+	if query == "" {
+		b.search = nil
+		b.refreshHighlights(previous)
+		return
+	}
+
+	id := b.searches
+	urls := make([]string, len(b.Chapters))
+	for i, c := range b.Chapters {
+		urls[i] = c.URL()
+	}
+	message := fmt.Sprintf("searching for %q", query)
+	b.message = message
+	go func() {
+		s, err := searchChapters(b.ebook, urls, query, caseSensitive)
+		b.app.QueueUpdateDraw(func() {
+			if id != b.searches {
+				return
+			}
+			if b.message == message {
+				b.message = ""
+			}
+			if err != nil {
+				s = &Search{Query: query, CaseSensitive: caseSensitive, Err: err}
+			}
+
+			previous := b.search
+			b.search = s
+			b.refreshHighlights(previous)
+			b.refreshHighlights(s)
+			if len(s.Matches) > 0 {
+				s.Current = b.firstMatchFrom(b.Current)
+				b.goToMatch()
+			}
+		})
+	}()
+}
+
+// searchChapters looks for query in the text of the chapters at urls.
+func searchChapters(r Reader, urls []string, query string, caseSensitive bool) (*Search, error) {
+	s := &Search{
+		Query:         query,
+		CaseSensitive: caseSensitive,
+	}
+	if !caseSensitive {
+		query = strings.ToLower(query)
+	}
+
+	for idx, u := range urls {
+		text, err := r.ReadChapter(u)
+		if err != nil {
+			return nil, err
+		}
+
+		for i, line := range strings.Split(text, "\n") {
+			if !caseSensitive {
+				line = strings.ToLower(line)
+			}
+			if !strings.Contains(line, query) {
+				continue
+			}
+
+			s.Matches = append(s.Matches, SearchMatch{
+				Chapter: idx,
+				Line:    i,
+			})
+		}
+	}
+
+	return s, nil
+}
+
+// firstMatchFrom returns the first match from the line of the text at the
+// top of the chapter, the first one of the book from the table of contents.
+// Matches refer to the lines of the text, not to the lines as shown.
+func (b Book) firstMatchFrom(chapter int) int {
+	line := -1
+	if chapter != b.TOC.Index() {
+		c := b.Chapters[chapter]
+		line = c.sourceLine(c.GetOffset())
+	}
+
+	for i, m := range b.search.Matches {
+		if m.Chapter > chapter || (m.Chapter == chapter && m.Line >= line) {
+			return i
+		}
+	}
+
+	return 0
+}
+
+func (b *Book) goToMatch() {
+	m := b.search.Matches[b.search.Current]
+	b.RefreshChapter(b.Chapters[m.Chapter])
+
+	b.recordJump()
+	if b.Current != m.Chapter {
+		b.GoToPage(m.Chapter)
+	}
+	b.Chapters[m.Chapter].ScrollToSourceLine(m.Line, b.ScrollOff)
+}
+
+func (b *Book) NextMatch() {
+	if b.search == nil || len(b.search.Matches) == 0 {
+		return
+	}
+
+	previous := b.search.Matches[b.search.Current]
+	b.search.Current = (b.search.Current + 1) % len(b.search.Matches)
+	b.RefreshChapter(b.Chapters[previous.Chapter])
+	b.goToMatch()
+}
+
+func (b *Book) PreviousMatch() {
+	if b.search == nil || len(b.search.Matches) == 0 {
+		return
+	}
+
+	previous := b.search.Matches[b.search.Current]
+	b.search.Current = (b.search.Current - 1 + len(b.search.Matches)) % len(b.search.Matches)
+	b.RefreshChapter(b.Chapters[previous.Chapter])
+	b.goToMatch()
+}
+
+// refreshHighlights re-renders every chapter containing a match for s, so
+// that highlights are added or stripped according to the active search.
+func (b *Book) refreshHighlights(s *Search) {
+	if s == nil {
+		return
+	}
+
+	done := map[int]bool{}
+	for _, m := range s.Matches {
+		if done[m.Chapter] {
+			continue
+		}
+		done[m.Chapter] = true
+		b.RefreshChapter(b.Chapters[m.Chapter])
+	}
+}
+
+// highlight escapes the line i of the chapter idx for use in a dynamic-colors
+// TextView, rendering its inline formatting and highlighting matches of the
+// active search. The line may have been wrapped into several by formatting,
+// and its spaces stretched, so matches are found in the source line before
+// formatting and mapped to the formatted one.
+func (b *Book) highlight(idx, i int, source, line string) string {
+	emphasis := emphasisTag(b.Theme)
+	sublines := strings.Split(line, "\n")
+
+	if b.search == nil || len(b.search.Matches) == 0 {
+		for j, subline := range sublines {
+			sublines[j] = renderLine(subline, nil, "", emphasis)
+		}
+		return strings.Join(sublines, "\n")
+	}
+
+	color := "[black:yellow]"
+	current := b.search.Matches[b.search.Current]
+	if current.Chapter == idx && current.Line == i {
+		color = "[black:orange]"
+	}
+	matches := findMatches(stripMarkup(source), b.search.Query, b.search.CaseSensitive)
+	mapped := mapMatches(stripMarkup(source), sublines, matches)
+	for j, subline := range sublines {
+		sublines[j] = renderLine(subline, mapped[j], color, emphasis)
+	}
+
+	return strings.Join(sublines, "\n")
+}
+
+// mapMatches maps the byte ranges of matches in source to the lines it was
+// formatted into, which hold the same characters apart from whitespace. Each
+// match is located by its non-space characters, so that a match spanning
+// several lines is split into a range on each of them.
+func mapMatches(source string, sublines []string, matches [][2]int) [][][2]int {
+	mapped := make([][][2]int, len(sublines))
+	if len(matches) == 0 {
+		return mapped
+	}
+
+	// nonSpace returns the byte offset of each non-space character of s
+	nonSpace := func(s string) []int {
+		var offsets []int
+		for i, r := range s {
+			if !unicode.IsSpace(r) {
+				offsets = append(offsets, i)
+			}
+		}
+		return offsets
+	}
+	// count returns the number of non-space characters before the byte
+	// offset i
+	sourceOffsets := nonSpace(source)
+	count := func(i int) int {
+		return sort.SearchInts(sourceOffsets, i)
+	}
+
+	first := 0
+	for j, subline := range sublines {
+		stripped := stripMarkup(subline)
+		offsets := nonSpace(stripped)
+		last := first + len(offsets)
+		for _, m := range matches {
+			start, end := count(m[0]), count(m[1])
+			if start < first {
+				start = first
+			}
+			if end > last {
+				end = last
+			}
+			if start >= end {
+				continue
+			}
+
+			endOffset := offsets[end-1-first]
+			_, size := utf8.DecodeRuneInString(stripped[endOffset:])
+			mapped[j] = append(mapped[j], [2]int{offsets[start-first], endOffset + size})
+		}
+		first = last
+	}
+
+	return mapped
+}
+
+// findMatches returns the byte ranges of the occurrences of query in line.
+func findMatches(line, query string, caseSensitive bool) [][2]int {
+	haystack, needle := line, query
+	if !caseSensitive {
+		haystack, needle = strings.ToLower(line), strings.ToLower(query)
+	}
+	if len(haystack) != len(line) || needle == "" {
+		// lowercasing changed byte offsets, matches can't be mapped back
+		return nil
+	}
+
+	var matches [][2]int
+	offset := 0
+	for {
+		i := strings.Index(haystack[offset:], needle)
+		if i == -1 {
+			break
+		}
+		matches = append(matches, [2]int{offset + i, offset + i + len(needle)})
+		offset += i + len(needle)
+	}
+
+	return matches
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMapMatchesWrapped(t *testing.T) {
+	source := "Once upon a time, the quick brown fox met another quick brown fox, and then the very quick brown fox left them."
+	query := "quick brown fox"
+	matches := findMatches(source, query, false)
+	if len(matches) != 3 {
+		t.Fatalf("findMatches = %v, expected 3 matches", matches)
+	}
+
+	for _, width := range []int{20, 33} {
+		for _, justified := range []bool{false, true} {
+			sublines := strings.Split(breakLines(source, width, nil, justified), "\n")
+			mapped := mapMatches(source, sublines, matches)
+			if len(mapped) != len(sublines) {
+				t.Fatalf("width %d: mapMatches returned %d lines, expected %d", width, len(mapped), len(sublines))
+			}
+
+			var highlighted []string
+			for j, ranges := range mapped {
+				for _, r := range ranges {
+					text := sublines[j][r[0]:r[1]]
+					if strings.TrimSpace(text) != text {
+						t.Errorf("width %d, justified %t: highlight %q of line %q starts or ends with a space", width, justified, text, sublines[j])
+					}
+					highlighted = append(highlighted, text)
+				}
+			}
+			if len(highlighted) <= len(matches) {
+				t.Errorf("width %d, justified %t: no match spans a line break in %q", width, justified, sublines)
+			}
+
+			// whitespace aside, the highlights hold the matches and
+			// nothing else
+			actual := strings.Join(strings.Fields(strings.Join(highlighted, " ")), "")
+			expected := strings.Repeat(strings.Replace(query, " ", "", -1), len(matches))
+			if actual != expected {
+				t.Errorf("width %d, justified %t: highlighted %q, expected %q", width, justified, highlighted, expected)
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell"
+)
+
+// StartSelection enters visual mode, selecting the line at the top of the
+// current chapter. The selection is then extended with j and k, copied with
+// the yank key, annotated with the add_note key, looked up with the look_up
+// key or cited with the cite key, and escape cancels it.
+func (b *Book) StartSelection() {
+	if b.Current == b.TOC.Index() {
+		return
+	}
+	c := b.Chapters[b.Current]
+	if !c.loaded {
+		return
+	}
+
+	c.selecting = true
+	c.selectAnchor = c.GetOffset()
+	c.selectCursor = c.selectAnchor
+	b.Flash("visual mode: j/k to extend, y to copy, a to add a note, K to look up, c to cite, escape to cancel")
+}
+
+// handleSelection handles the keys pressed in visual mode, other keys being
+// ignored until the selection is done.
+func (b *Book) handleSelection(event *tcell.EventKey) {
+	c := b.Chapters[b.Current]
+
+	switch {
+	case event.Key() == tcell.KeyEscape:
+		c.selecting = false
+	case event.Key() == tcell.KeyDown || event.Rune() == b.key("menu_down"):
+		b.moveCursor(c, 1)
+	case event.Key() == tcell.KeyUp || event.Rune() == b.key("menu_up"):
+		b.moveCursor(c, -1)
+	case event.Rune() == b.key("yank"):
+		c.selecting = false
+		b.copyText(c, c.selectionText())
+	case event.Rune() == b.key("add_note"):
+		c.selecting = false
+		first, _ := c.selection()
+		b.showAddNote(first, c.selectionText())
+	case event.Rune() == b.key("look_up"):
+		c.selecting = false
+		b.lookUp(c.selectionText())
+	case event.Rune() == b.key("cite"):
+		c.selecting = false
+		first, _ := c.selection()
+		b.cite(first, c.selectionText())
+	case event.Rune() == b.key("visual"):
+		c.selecting = false
+	}
+}
+
+// moveCursor moves the end of the selection by n lines, scrolling to keep it
+// in view.
+func (b *Book) moveCursor(c *Chapter, n int) {
+	lines, err := c.t.NLines()
+	if err != nil {
+		return
+	}
+
+	c.selectCursor += n
+	if c.selectCursor >= lines {
+		c.selectCursor = lines - 1
+	}
+	if c.selectCursor < 0 {
+		c.selectCursor = 0
+	}
+
+	offset := c.GetOffset()
+	switch {
+	case c.selectCursor < offset:
+		c.SetOffset(c.selectCursor)
+	case c.selectCursor >= offset+c.visibleLines():
+		c.SetOffset(c.selectCursor - c.visibleLines() + 1)
+	}
+}
+
+// selection returns the first and last selected lines.
+func (c Chapter) selection() (int, int) {
+	if c.selectCursor < c.selectAnchor {
+		return c.selectCursor, c.selectAnchor
+	}
+
+	return c.selectAnchor, c.selectCursor
+}
+
+// selectionText returns the plain text of the selected lines, the lines of a
+// paragraph being joined back together.
+func (c Chapter) selectionText() string {
+	lines := c.wrappedLines()
+	first, last := c.selection()
+	if first >= len(lines) {
+		return ""
+	}
+	if last >= len(lines) {
+		last = len(lines) - 1
+	}
+
+	return joinLines(lines[first : last+1])
+}
+
+// joinLines joins wrapped lines back into paragraphs, separated by blank
+// lines.
+func joinLines(lines []string) string {
+	var paragraphs, words []string
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line != "" {
+			words = append(words, strings.Fields(line)...)
+			continue
+		}
+		if len(words) > 0 {
+			paragraphs = append(paragraphs, strings.Join(words, " "))
+			words = nil
+		}
+	}
+	if len(words) > 0 {
+		paragraphs = append(paragraphs, strings.Join(words, " "))
+	}
+
+	return strings.Join(paragraphs, "\n\n")
+}
+
+// paragraphText returns the first line and the text of the paragraph at or
+// after the wrapped line r.
+func (c Chapter) paragraphText(r int) (int, string) {
+	lines := c.wrappedLines()
+	if r < 0 {
+		r = 0
+	}
+	for r < len(lines) && strings.TrimSpace(lines[r]) == "" {
+		r++
+	}
+	if r >= len(lines) {
+		return r, ""
+	}
+
+	first, last := r, r
+	for first > 0 && strings.TrimSpace(lines[first-1]) != "" {
+		first--
+	}
+	for last+1 < len(lines) && strings.TrimSpace(lines[last+1]) != "" {
+		last++
+	}
+
+	return first, joinLines(lines[first : last+1])
+}
+
+// drawSelection shows the visible part of the selection in reverse video,
+// following the text to the second column when shown.
+func (b *Book) drawSelection(screen tcell.Screen) {
+	if b.overlay != "" || b.Current == b.TOC.Index() {
+		return
+	}
+	c := b.Chapters[b.Current]
+	if !c.selecting {
+		return
+	}
+
+	x, y, width, height := c.t.GetRect()
+	rightX, _, _, _ := c.right.GetRect()
+	offset := c.GetOffset()
+	first, last := c.selection()
+	for r := first; r <= last; r++ {
+		row, left := r-offset, x
+		if row >= height && b.columns {
+			row, left = row-height, rightX
+		}
+		if row < 0 || row >= height {
+			continue
+		}
+
+		for cx := left; cx < left+width; cx++ {
+			ch, combining, style, _ := screen.GetContent(cx, y+row)
+			screen.SetContent(cx, y+row, ch, combining, style.Reverse(true))
+		}
+	}
+}
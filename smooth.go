@@ -0,0 +1,67 @@
+package main
+
+import (
+	"time"
+)
+
+// DefaultScrollDuration is the duration of smooth scrolling when not
+// configured.
+const DefaultScrollDuration = 150 * time.Millisecond
+
+// scrollSteps is the number of frames a smooth scroll is drawn in.
+const scrollSteps = 8
+
+type scrollAnimation struct {
+	chapter *Chapter
+	target  int
+}
+
+// SmoothScrollBy scrolls the current chapter by n lines like ScrollBy,
+// animated over ScrollDuration when SmoothScroll is set.
+func (b *Book) SmoothScrollBy(n int) {
+	if !b.SmoothScroll || b.Current == b.TOC.Index() {
+		b.ScrollBy(n)
+		return
+	}
+	c := b.Chapters[b.Current]
+	if !c.loaded {
+		b.ScrollBy(n)
+		return
+	}
+
+	start := c.GetOffset()
+	target := start + n
+	if target < 0 {
+		target = 0
+	}
+	a := &scrollAnimation{chapter: c, target: target}
+	b.scrolling = a
+
+	go func() {
+		for i := 1; i <= scrollSteps; i++ {
+			time.Sleep(b.ScrollDuration / scrollSteps)
+			i := i
+			b.app.QueueUpdateDraw(func() {
+				if b.scrolling != a {
+					return
+				}
+				c.SetOffset(start + (target-start)*i/scrollSteps)
+				if i == scrollSteps {
+					b.scrolling = nil
+				}
+			})
+		}
+	}()
+}
+
+// finishScrolling cancels the animation in progress, scrolling to its target
+// at once. It is called on each key press, so that keys apply from the
+// target rather than from wherever the animation was.
+func (b *Book) finishScrolling() {
+	a := b.scrolling
+	if a == nil {
+		return
+	}
+	b.scrolling = nil
+	a.chapter.SetOffset(a.target)
+}
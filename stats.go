@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gdamore/tcell"
+)
+
+// SessionTime returns the time spent reading since the book was opened, not
+// counting the time the reader was paused.
+func (b Book) SessionTime() time.Duration {
+	if b.sessionStart.IsZero() {
+		return 0
+	}
+
+	end := time.Now()
+	if !b.pausedAt.IsZero() {
+		end = b.pausedAt
+	}
+
+	return end.Sub(b.sessionStart) - b.paused
+}
+
+// TotalReadingTime returns the time spent reading the book over all sessions.
+func (b Book) TotalReadingTime() time.Duration {
+	return b.ReadingTime + b.SessionTime()
+}
+
+// PauseTimer stops counting the session time, until ResumeTimer is called.
+func (b *Book) PauseTimer() {
+	if b.pausedAt.IsZero() {
+		b.pausedAt = time.Now()
+	}
+}
+
+func (b *Book) ResumeTimer() {
+	if b.pausedAt.IsZero() {
+		return
+	}
+	b.paused += time.Since(b.pausedAt)
+	b.pausedAt = time.Time{}
+}
+
+func formatDuration(d time.Duration) string {
+	d = d.Round(time.Minute)
+
+	return fmt.Sprintf("%dh%02d", int(d.Hours()), int(d.Minutes())%60)
+}
+
+// Progress returns the fraction of the book read at the current position, or
+// at the last chapter read when on the table of contents.
+func (b Book) Progress() float64 {
+	idx := b.Current
+	if idx == b.TOC.Index() {
+		idx = b.menuContext
+	}
+	if idx < 0 || idx >= len(b.Chapters) {
+		return 0
+	}
+
+	return b.BookProgress(idx, b.Chapters[idx].GetOffset())
+}
+
+// FurthestProgress returns the fraction of the book read at the furthest
+// position reached, in the last chapter opened.
+func (b Book) FurthestProgress() float64 {
+	idx := -1
+	for i := range b.Furthest {
+		if i > idx && i < len(b.Chapters) {
+			idx = i
+		}
+	}
+	if idx == -1 {
+		return 0
+	}
+
+	line := 0
+	if n := b.LineCounts[idx]; n > 0 {
+		line = int(b.Furthest[idx] * float64(n))
+	}
+
+	return b.BookProgress(idx, line)
+}
+
+func (b *Book) ShowStats() {
+	lines := []string{
+		fmt.Sprintf("Total reading time  %s", formatDuration(b.TotalReadingTime())),
+		fmt.Sprintf("This session        %s", formatDuration(b.SessionTime())),
+		fmt.Sprintf("Sessions            %d", b.Sessions),
+		fmt.Sprintf("Book completed      %.0f%% furthest, %.0f%% current", 100*b.FurthestProgress(), 100*b.Progress()),
+	}
+	if streak := b.streakText(); streak != "" {
+		lines = append(lines, fmt.Sprintf("Reading streak      %s", streak))
+	}
+
+	t := newOverlayText(b.Theme, "Reading statistics", strings.Join(lines, "\n"))
+	t.SetDoneFunc(func(tcell.Key) {
+		b.HideOverlay()
+	})
+
+	b.ShowOverlay("stats", t, b.Width, len(lines)+2)
+}
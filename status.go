@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const flashDuration = 3 * time.Second
+
+// Flash shows msg in the status bar for a few seconds.
+func (b *Book) Flash(msg string) {
+	b.message = msg
+	time.AfterFunc(flashDuration, func() {
+		b.app.QueueUpdateDraw(func() {
+			if b.message == msg {
+				b.message = ""
+			}
+		})
+	})
+}
+
+func (b *Book) StatusMessage() string {
+	if b.message != "" {
+		return " - " + b.message
+	}
+	if b.search == nil {
+		return ""
+	}
+	if b.search.Err != nil {
+		return fmt.Sprintf(" - search failed: %s", b.search.Err)
+	}
+	if len(b.search.Matches) == 0 {
+		return fmt.Sprintf(" - no match for %q", b.search.Query)
+	}
+
+	return fmt.Sprintf(" - match %d/%d for %q", b.search.Current+1, len(b.search.Matches), b.search.Query)
+}
+
+func (b *Book) statusText() string {
+	if b.Current == b.TOC.Index() {
+		i := b.TOC.Selected()
+		if i == -1 {
+			return fmt.Sprintf("Table of contents - no chapter matching %q%s", b.TOC.filter, b.StatusMessage())
+		}
+		return fmt.Sprintf("Table of contents - %q (%d/%d)%s", b.chapterTitle(i), i+1, len(b.Chapters), b.StatusMessage())
+	}
+
+	c := b.Chapters[b.Current]
+	if !c.loaded {
+		return fmt.Sprintf("%q - loading%s", c.title, b.StatusMessage())
+	}
+
+	line := c.GetOffset()
+	_, _, _, h := c.t.GetRect()
+
+	nLines, err := c.t.NLines()
+	if err != nil {
+		return fmt.Sprintf("%q - lines %d-%d%s", c.title, line+1, line+h+1, b.StatusMessage())
+	}
+
+	b.LineCounts[b.Current] = nLines
+	if line+h >= nLines {
+		h = nLines - line - 1
+	}
+
+	return fmt.Sprintf(
+		"%q - lines %d-%d/%d - %.0f%% of book - %s chapter, %s book%s%s",
+		c.title, line+1, line+h+1, nLines,
+		100*b.BookProgress(b.Current, line),
+		formatMinutes(b.ChapterMinutes(b.Current)), formatMinutes(b.BookMinutes()),
+		b.notesStatus(b.Current, line, line+h),
+		b.StatusMessage(),
+	)
+}
+
+// updateStatus refreshes the status and progress bars, redrawing the screen
+// only when their content changed.
+func (b *Book) updateStatus() {
+	text, progress := b.statusText(), b.progressText()
+	if text == b.statusLine && progress == b.progressLine {
+		return
+	}
+
+	b.statusLine, b.progressLine = text, progress
+	b.status.SetText(text)
+	b.progress.SetText(progress)
+	b.app.Draw()
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"time"
+)
+
+// StatusReport is the reading progress of a book as printed by -status-json,
+// for other programs to consume.
+type StatusReport struct {
+	File  string
+	Title string
+	// Chapter is the number of the current chapter, 0 when the book was
+	// left on the table of contents before opening any chapter.
+	Chapter      int
+	ChapterTitle string
+	Chapters     int
+	// Percent is the part of the book read at the current position, the
+	// chapters being weighted by their number of words.
+	Percent  float64
+	LastRead time.Time
+	Marks    []MarkReport
+}
+
+type MarkReport struct {
+	Name         string
+	Chapter      int
+	ChapterTitle string
+	Line         int
+	Preview      string
+}
+
+// printStatusJSON prints the saved reading progress of each book as a JSON
+// object on its own line, failing for books that were never opened.
+func printStatusJSON(w io.Writer, fnames []string) error {
+	enc := json.NewEncoder(w)
+	for _, fname := range fnames {
+		report, err := statusReport(fname)
+		if err != nil {
+			return err
+		}
+		err = enc.Encode(report)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func statusReport(fname string) (StatusReport, error) {
+	state, exists, err := LoadState(fname)
+	if err != nil {
+		return StatusReport{}, fmt.Errorf("%s: reading the state file: %s", stateFname(fname), err)
+	}
+	if !exists {
+		return StatusReport{}, fmt.Errorf("%s: no saved state, the book was never opened", fname)
+	}
+
+	ebook, err := openBook(fname)
+	if err != nil {
+		return StatusReport{}, err
+	}
+	defer ebook.Close()
+
+	toc, err := ebook.TOC()
+	if err != nil {
+		return StatusReport{}, fmt.Errorf("%s: reading table of contents: %s", fname, err)
+	}
+	counts := state.Words
+	if !counts.Valid(fname, len(toc)) {
+		c, err := countBookWords(fname, ebook, toc)
+		if err != nil {
+			return StatusReport{}, fmt.Errorf("%s: counting words: %s", fname, err)
+		}
+		counts = &c
+	}
+
+	report := StatusReport{
+		File:     fname,
+		Title:    bookTitle(ebook),
+		Chapters: len(toc),
+		LastRead: state.LastRead,
+		Marks:    []MarkReport{},
+	}
+	if report.Title == "" {
+		report.Title = filepath.Base(fname)
+	}
+	chapterTitle := func(idx int) string {
+		if idx < 0 || idx >= len(toc) {
+			return ""
+		}
+		return toc[idx].Name
+	}
+
+	if state.Page >= 0 && state.Page < len(toc) {
+		report.Chapter = state.Page + 1
+		report.ChapterTitle = chapterTitle(state.Page)
+
+		read := 0
+		for _, n := range counts.Chapters[:state.Page] {
+			read += n
+		}
+		read += int(state.Fractions[state.Page] * float64(counts.Chapters[state.Page]))
+		if total := counts.Total(); total > 0 {
+			report.Percent = 100 * float64(read) / float64(total)
+		}
+	}
+
+	for _, name := range (Book{Marks: state.Marks}).markNames() {
+		m := state.Marks[name]
+		report.Marks = append(report.Marks, MarkReport{
+			Name:         string(name),
+			Chapter:      m.Chapter + 1,
+			ChapterTitle: chapterTitle(m.Chapter),
+			Line:         m.Line + 1,
+			Preview:      m.Preview,
+		})
+	}
+
+	return report, ebook.SaveCache()
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Suspend saves the state and gives the terminal back to the shell, like
+// Ctrl-Z does for other programs, until the job is resumed. The time spent
+// suspended isn't counted as reading time.
+func (b *Book) Suspend() {
+	err := SaveState(b.fname, b.State())
+	if err != nil {
+		b.Flash(fmt.Sprintf("saving state: %s", err))
+	}
+
+	b.PauseTimer()
+	if b.mouse != nil {
+		err = b.mouse.Suspend(stopProcess)
+		if err != nil {
+			b.app.Stop()
+		}
+	} else {
+		b.app.Suspend(stopProcess)
+	}
+	b.ResumeTimer()
+}
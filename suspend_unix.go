@@ -0,0 +1,14 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"syscall"
+)
+
+// stopProcess stops the process until it receives SIGCONT, when the job is
+// brought back to the foreground.
+func stopProcess() {
+	_ = syscall.Kill(syscall.Getpid(), syscall.SIGSTOP)
+}
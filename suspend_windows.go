@@ -0,0 +1,4 @@
+package main
+
+// stopProcess does nothing, Windows has no job control.
+func stopProcess() {}
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+	"unicode/utf8"
+)
+
+// NotesDump is the reading position, marks and notes of a book as printed by
+// -dump-notes and merged back by -import-notes, to sync them between
+// machines. Chapters and lines are numbered from 1, along with the title of
+// the chapter so that it can be found again if the chapters moved.
+type NotesDump struct {
+	File     string
+	Title    string
+	Position PositionDump
+	Furthest []ProgressDump
+	Marks    []MarkDump
+	Notes    []NoteDump
+}
+
+// PositionDump is the position the book was left at, at Time. Chapter is 0
+// when it was left on the table of contents.
+type PositionDump struct {
+	Chapter      int
+	ChapterTitle string
+	Fraction     float64
+	Time         time.Time
+}
+
+// ProgressDump is the furthest fraction of a chapter read.
+type ProgressDump struct {
+	Chapter      int
+	ChapterTitle string
+	Fraction     float64
+}
+
+// MarkDump is a mark at the line of the chapter's text Line, which doesn't
+// depend on the width the book is shown at. Line is 0 for marks saved by
+// older versions whose chapter wasn't shown since, ShownLine being the line
+// as shown then.
+type MarkDump struct {
+	Name         string
+	Chapter      int
+	ChapterTitle string
+	Line         int
+	ShownLine    int
+	Preview      string
+	Time         time.Time
+}
+
+// NoteDump is a note, at a line like MarkDump.
+type NoteDump struct {
+	Chapter      int
+	ChapterTitle string
+	Line         int
+	ShownLine    int
+	Text         string
+	Preview      string
+	Time         time.Time
+}
+
+// dumpLines returns the line of the text and the line as shown of a mark or
+// a note to dump, the latter only when the former isn't known.
+func dumpLines(line, sourceLine int) (int, int) {
+	if sourceLine < 0 {
+		return 0, line + 1
+	}
+
+	return sourceLine + 1, 0
+}
+
+// importedLines returns the line as shown and the line of the text of a
+// dumped mark or note. The line as shown is found again once the chapter is
+// rendered.
+func importedLines(line, shownLine int) (int, int) {
+	if line <= 0 {
+		return shownLine - 1, -1
+	}
+
+	return 0, line - 1
+}
+
+// printNotesDump prints the position, marks and notes of each book as a JSON
+// document, failing for books that were never opened.
+func printNotesDump(w io.Writer, fnames []string) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	for _, fname := range fnames {
+		state, exists, err := LoadState(fname)
+		if err != nil {
+			return fmt.Errorf("%s: reading the state file: %s", stateFname(fname), err)
+		}
+		if !exists {
+			return fmt.Errorf("%s: no saved state, the book was never opened", fname)
+		}
+		toc, title, err := readTOC(fname)
+		if err != nil {
+			return err
+		}
+
+		err = enc.Encode(notesDump(fname, title, toc, state))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// readTOC returns the table of contents and the title of the book.
+func readTOC(fname string) ([]TOCEntry, string, error) {
+	ebook, err := openBook(fname)
+	if err != nil {
+		return nil, "", err
+	}
+	defer ebook.Close()
+
+	toc, err := ebook.TOC()
+	if err != nil {
+		return nil, "", fmt.Errorf("%s: reading table of contents: %s", fname, err)
+	}
+	title := bookTitle(ebook)
+	if title == "" {
+		title = filepath.Base(fname)
+	}
+
+	return toc, title, nil
+}
+
+func notesDump(fname, title string, toc []TOCEntry, state State) NotesDump {
+	chapterTitle := func(idx int) string {
+		if idx < 0 || idx >= len(toc) {
+			return ""
+		}
+		return toc[idx].Name
+	}
+
+	dump := NotesDump{
+		File:  fname,
+		Title: title,
+		Position: PositionDump{
+			Chapter:      state.Page + 1,
+			ChapterTitle: chapterTitle(state.Page),
+			Fraction:     state.Fractions[state.Page],
+			Time:         state.LastRead,
+		},
+		Furthest: []ProgressDump{},
+		Marks:    []MarkDump{},
+		Notes:    []NoteDump{},
+	}
+
+	chapters := make([]int, 0, len(state.Furthest))
+	for idx := range state.Furthest {
+		chapters = append(chapters, idx)
+	}
+	sort.Ints(chapters)
+	for _, idx := range chapters {
+		dump.Furthest = append(dump.Furthest, ProgressDump{
+			Chapter:      idx + 1,
+			ChapterTitle: chapterTitle(idx),
+			Fraction:     state.Furthest[idx],
+		})
+	}
+	for _, name := range (Book{Marks: state.Marks}).markNames() {
+		m := state.Marks[name]
+		line, shownLine := dumpLines(m.Line, m.SourceLine)
+		dump.Marks = append(dump.Marks, MarkDump{
+			Name:         string(name),
+			Chapter:      m.Chapter + 1,
+			ChapterTitle: chapterTitle(m.Chapter),
+			Line:         line,
+			ShownLine:    shownLine,
+			Preview:      m.Preview,
+			Time:         m.Time,
+		})
+	}
+	for _, n := range state.Notes {
+		line, shownLine := dumpLines(n.Line, n.SourceLine)
+		dump.Notes = append(dump.Notes, NoteDump{
+			Chapter:      n.Chapter + 1,
+			ChapterTitle: chapterTitle(n.Chapter),
+			Line:         line,
+			ShownLine:    shownLine,
+			Text:         n.Text,
+			Preview:      n.Preview,
+			Time:         n.Time,
+		})
+	}
+
+	return dump
+}
+
+// importNotes merges the position, marks and notes dumped to dumpFname into
+// the state of the book, printing what changed to w.
+func importNotes(w io.Writer, fname, dumpFname string) error {
+	f, err := os.Open(dumpFname)
+	if err != nil {
+		return err
+	}
+	var dump NotesDump
+	err = json.NewDecoder(f).Decode(&dump)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("%s: %s", dumpFname, err)
+	}
+
+	state, exists, err := LoadState(fname)
+	if err != nil {
+		return fmt.Errorf("%s: reading the state file: %s", stateFname(fname), err)
+	}
+	if !exists {
+		state = State{Version: stateVersion, Page: -1, TOCSelected: -1}
+	}
+	toc, _, err := readTOC(fname)
+	if err != nil {
+		return err
+	}
+
+	changes := mergeNotes(&state, dump, toc)
+	fmt.Fprintf(w, "%s: %d marks, %d notes, position %s\n", fname, changes.marks, changes.notes, changes.position)
+
+	return writeState(fname, state)
+}
+
+type mergeChanges struct {
+	marks, notes int
+	position     string
+}
+
+// mergeNotes merges dump into state. Marks and the position are replaced
+// when the dumped ones are newer, notes are added unless already there, the
+// newest copy being kept, and the furthest fractions read are kept.
+func mergeNotes(state *State, dump NotesDump, toc []TOCEntry) mergeChanges {
+	changes := mergeChanges{position: "kept"}
+	if state.Marks == nil {
+		state.Marks = map[rune]Mark{}
+	}
+	if state.Furthest == nil {
+		state.Furthest = map[int]float64{}
+	}
+	if state.Fractions == nil {
+		state.Fractions = map[int]float64{}
+	}
+
+	if p := dump.Position; p.Time.After(state.LastRead) {
+		if idx, ok := dumpedChapter(toc, p.Chapter, p.ChapterTitle); ok {
+			state.Page = idx
+			state.TOCSelected = idx
+			if idx >= 0 {
+				state.Fractions[idx] = p.Fraction
+				delete(state.Offsets, idx)
+			}
+			state.LastRead = p.Time
+			changes.position = "updated"
+		}
+	}
+
+	for _, p := range dump.Furthest {
+		idx, ok := dumpedChapter(toc, p.Chapter, p.ChapterTitle)
+		if ok && idx >= 0 && p.Fraction > state.Furthest[idx] {
+			state.Furthest[idx] = p.Fraction
+		}
+	}
+
+	for _, m := range dump.Marks {
+		name, size := utf8.DecodeRuneInString(m.Name)
+		if size == 0 || size != len(m.Name) {
+			continue
+		}
+		idx, ok := dumpedChapter(toc, m.Chapter, m.ChapterTitle)
+		if !ok || idx < 0 {
+			continue
+		}
+		if existing, ok := state.Marks[name]; ok && !m.Time.After(existing.Time) {
+			continue
+		}
+		line, sourceLine := importedLines(m.Line, m.ShownLine)
+		state.Marks[name] = Mark{Chapter: idx, Line: line, SourceLine: sourceLine, Preview: m.Preview, Time: m.Time}
+		changes.marks++
+	}
+
+	for _, n := range dump.Notes {
+		idx, ok := dumpedChapter(toc, n.Chapter, n.ChapterTitle)
+		if !ok || idx < 0 {
+			continue
+		}
+		line, sourceLine := importedLines(n.Line, n.ShownLine)
+		note := Note{Chapter: idx, Line: line, SourceLine: sourceLine, Text: n.Text, Preview: n.Preview, Time: n.Time}
+
+		found := false
+		for i, existing := range state.Notes {
+			if existing.Chapter != note.Chapter || existing.Text != note.Text {
+				continue
+			}
+			if existing.SourceLine >= 0 && note.SourceLine >= 0 {
+				if existing.SourceLine != note.SourceLine {
+					continue
+				}
+			} else if existing.Line != note.Line {
+				continue
+			}
+			found = true
+			if note.Time.After(existing.Time) {
+				state.Notes[i] = note
+				changes.notes++
+			}
+			break
+		}
+		if !found {
+			state.Notes = append(state.Notes, note)
+			changes.notes++
+		}
+	}
+	sortNotes(state.Notes)
+
+	return changes
+}
+
+// dumpedChapter returns the index of the chapter dumped with the given
+// number and title: the chapter with that number if its title matches, else
+// the first one with that title, else the chapter with that number. It
+// returns -1 for the table of contents.
+func dumpedChapter(toc []TOCEntry, n int, title string) (int, bool) {
+	if n == 0 {
+		return -1, true
+	}
+	if n >= 1 && n <= len(toc) && toc[n-1].Name == title {
+		return n - 1, true
+	}
+	for i, entry := range toc {
+		if title != "" && entry.Name == title {
+			return i, true
+		}
+	}
+	if n >= 1 && n <= len(toc) {
+		return n - 1, true
+	}
+
+	return 0, false
+}
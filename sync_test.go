@@ -0,0 +1,63 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestNotesDumpRoundTrip(t *testing.T) {
+	toc := []TOCEntry{{Name: "One", URL: "one.xhtml"}, {Name: "Two", URL: "two.xhtml"}}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	state := State{
+		Version: stateVersion,
+		Page:    1,
+		Marks: map[rune]Mark{
+			'a': {Chapter: 1, Line: 42, SourceLine: 7, Time: now},
+			// saved by an older version, not shown since
+			'b': {Chapter: 0, Line: 12, SourceLine: -1, Time: now},
+		},
+		Notes: []Note{
+			{Chapter: 1, Line: 30, SourceLine: 5, Text: "note", Time: now},
+		},
+	}
+
+	dump := notesDump("book.epub", "Book", toc, state)
+	expectedMarks := []MarkDump{
+		{Name: "a", Chapter: 2, ChapterTitle: "Two", Line: 8, Time: now},
+		{Name: "b", Chapter: 1, ChapterTitle: "One", ShownLine: 13, Time: now},
+	}
+	if !reflect.DeepEqual(dump.Marks, expectedMarks) {
+		t.Errorf("dumped marks %+v, expected %+v", dump.Marks, expectedMarks)
+	}
+	expectedNotes := []NoteDump{
+		{Chapter: 2, ChapterTitle: "Two", Line: 6, Text: "note", Time: now},
+	}
+	if !reflect.DeepEqual(dump.Notes, expectedNotes) {
+		t.Errorf("dumped notes %+v, expected %+v", dump.Notes, expectedNotes)
+	}
+
+	// imported on a machine showing the book at another width, the lines as
+	// shown are found again once the chapters are rendered
+	imported := State{Version: stateVersion, Page: -1, TOCSelected: -1}
+	changes := mergeNotes(&imported, dump, toc)
+	if changes.marks != 2 || changes.notes != 1 {
+		t.Errorf("mergeNotes changed %d marks and %d notes, expected 2 and 1", changes.marks, changes.notes)
+	}
+	expected := map[rune]Mark{
+		'a': {Chapter: 1, Line: 0, SourceLine: 7, Time: now},
+		'b': {Chapter: 0, Line: 12, SourceLine: -1, Time: now},
+	}
+	if !reflect.DeepEqual(imported.Marks, expected) {
+		t.Errorf("imported marks %+v, expected %+v", imported.Marks, expected)
+	}
+	if n := imported.Notes; len(n) != 1 || n[0].SourceLine != 5 {
+		t.Errorf("imported notes %+v, expected one at the line 5 of the text", n)
+	}
+
+	// importing again doesn't add the note twice
+	mergeNotes(&imported, dump, toc)
+	if len(imported.Notes) != 1 {
+		t.Errorf("notes imported twice: %+v", imported.Notes)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+type Theme struct {
+	Name       string
+	Background tcell.Color
+	Foreground tcell.Color
+	// Accent is used for selections.
+	Accent tcell.Color
+}
+
+var Themes = []Theme{
+	{
+		Name:       "default",
+		Background: tcell.NewHexColor(0x002833),
+		Foreground: tcell.ColorDefault,
+		Accent:     tcell.NewHexColor(0x268bd2),
+	},
+	{
+		Name:       "solarized-dark",
+		Background: tcell.NewHexColor(0x002b36),
+		Foreground: tcell.NewHexColor(0x839496),
+		Accent:     tcell.NewHexColor(0x268bd2),
+	},
+	{
+		Name:       "light",
+		Background: tcell.NewHexColor(0xfdf6e3),
+		Foreground: tcell.ColorBlack,
+		Accent:     tcell.NewHexColor(0x93a1a1),
+	},
+}
+
+var DefaultTheme = Themes[0]
+
+func ThemeByName(name string) (Theme, bool) {
+	for _, theme := range Themes {
+		if theme.Name == name {
+			return theme, true
+		}
+	}
+
+	return Theme{}, false
+}
+
+// Night returns a warmer and dimmer variant of the theme, for reading at
+// night. It keeps the name of the theme it is derived from.
+func (t Theme) Night() Theme {
+	return Theme{
+		Name:       t.Name,
+		Background: blend(t.Background, 0x1a1008, 0.7),
+		Foreground: blend(t.Foreground, 0xb08a5a, 0.6),
+		Accent:     blend(t.Accent, 0x8a5a2b, 0.6),
+	}
+}
+
+// blend mixes c with the color target, in the given proportion of target.
+// Colors with no known RGB value, like the terminal default, are replaced by
+// target.
+func blend(c tcell.Color, target int32, amount float64) tcell.Color {
+	r, g, b := c.RGB()
+	if r < 0 || g < 0 || b < 0 {
+		return tcell.NewHexColor(target)
+	}
+
+	mix := func(v, t int32) int32 {
+		return int32(float64(v)*(1-amount) + float64(t)*amount)
+	}
+
+	return tcell.NewRGBColor(
+		mix(r, target>>16&0xff),
+		mix(g, target>>8&0xff),
+		mix(b, target&0xff),
+	)
+}
+
+func applyListTheme(l *tview.List, theme Theme) {
+	l.SetBackgroundColor(theme.Background)
+	l.SetMainTextColor(theme.Foreground)
+	l.SetSecondaryTextColor(theme.Accent)
+	l.SetSelectedBackgroundColor(theme.Accent)
+	l.SetSelectedTextColor(theme.Background)
+}
+
+func applyInputTheme(i *tview.InputField, theme Theme) {
+	i.SetBackgroundColor(theme.Background)
+	i.SetLabelColor(theme.Foreground)
+	i.SetFieldBackgroundColor(theme.Accent)
+	i.SetFieldTextColor(theme.Background)
+}
+
+// SetTheme switches to theme, using its night variant in night mode.
+func (b *Book) SetTheme(theme Theme) {
+	if b.Night {
+		theme = theme.Night()
+	}
+	b.Theme = theme
+
+	b.tPages.SetBackgroundColor(theme.Background)
+	b.base.SetBackgroundColor(theme.Background)
+	for _, t := range []*tview.TextView{b.title, b.status, b.progress} {
+		t.SetBackgroundColor(theme.Background)
+		t.SetTextColor(theme.Foreground)
+	}
+	for _, p := range b.Pages {
+		p.SetTheme(theme)
+	}
+	// emphasis is shown in the accent color
+	b.RefreshChapters()
+}
+
+func (b *Book) CycleTheme() {
+	next := 0
+	for i, theme := range Themes {
+		if theme.Name == b.Theme.Name {
+			next = (i + 1) % len(Themes)
+			break
+		}
+	}
+
+	b.SetTheme(Themes[next])
+	b.Flash(fmt.Sprintf("theme: %s", b.Theme.Name))
+}
+
+// SetNight turns night mode on or off, re-applying the current theme.
+func (b *Book) SetNight(night bool) {
+	theme, ok := ThemeByName(b.Theme.Name)
+	if !ok {
+		theme = DefaultTheme
+	}
+
+	b.Night = night
+	b.SetTheme(theme)
+}
+
+func (b *Book) ToggleNight() {
+	b.SetNight(!b.Night)
+	if b.Night {
+		b.Flash("night mode on")
+	} else {
+		b.Flash("night mode off")
+	}
+}
+
+// isNight reports whether hour falls in the night hours, from the hour from
+// included to until excluded, possibly wrapping around midnight.
+func isNight(hour, from, until int) bool {
+	if from <= until {
+		return hour >= from && hour < until
+	}
+
+	return hour >= from || hour < until
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/gdamore/tcell"
+	"github.com/rivo/tview"
+)
+
+func (b *Book) newTOCFilterInput() *tview.InputField {
+	input := tview.NewInputField()
+	applyInputTheme(input, b.Theme)
+	input.SetLabel("Filter: ")
+	input.SetChangedFunc(func(text string) {
+		b.TOC.SetFilter(text)
+	})
+	input.SetInputCapture(func(event *tcell.EventKey) *tcell.EventKey {
+		switch event.Key() {
+		case tcell.KeyUp, tcell.KeyDown:
+			b.TOC.l.InputHandler()(event, func(tview.Primitive) {})
+			return nil
+		}
+		return event
+	})
+	input.SetDoneFunc(func(key tcell.Key) {
+		if key == tcell.KeyEscape {
+			input.SetText("")
+		}
+		b.stopTOCFilter()
+	})
+
+	return input
+}
+
+// FilterTOC shows the table of contents and focuses its filter input, the
+// list being narrowed down to matching titles as characters are typed.
+func (b *Book) FilterTOC() {
+	if b.Current != b.TOC.Index() {
+		b.ToggleMenu()
+	}
+
+	b.overlay = "toc-filter"
+	b.TOC.showInput(true)
+	b.app.SetFocus(b.TOC.input)
+}
+
+func (b *Book) stopTOCFilter() {
+	b.overlay = ""
+	b.TOC.showInput(b.TOC.filter != "")
+	b.app.SetFocus(b.TOC.l)
+}
+
+func (t *TOC) showInput(show bool) {
+	t.g.Clear()
+	if !show {
+		t.g.SetRows(-1)
+		t.g.AddItem(t.l, 0, 1, 1, 1, 0, 0, true)
+		return
+	}
+
+	t.g.SetRows(1, 1, -1)
+	t.g.AddItem(t.input, 0, 1, 1, 1, 0, 0, false)
+	t.g.AddItem(t.l, 2, 1, 1, 1, 0, 0, true)
+}
+
+// SetFilter rebuilds the list with the entries whose title contains filter,
+// ignoring case. The selected entry stays selected if it still matches.
+func (t *TOC) SetFilter(filter string) {
+	selected := t.Selected()
+
+	t.filter = filter
+	t.indices = t.indices[:0]
+	t.l.Clear()
+
+	filter = strings.ToLower(filter)
+	for i, entry := range t.entries {
+		if !strings.Contains(strings.ToLower(entry.Name), filter) {
+			continue
+		}
+
+		j := i
+		t.indices = append(t.indices, i)
+		t.l.AddItem(entry.Name, t.secondary(i), 0, func() {
+			t.cb(j)
+		})
+	}
+
+	t.SetSelected(selected)
+}
+
+// Refresh updates the secondary text of the chapter idx, if listed.
+func (t *TOC) Refresh(idx int) {
+	for i, j := range t.indices {
+		if j == idx {
+			t.l.SetItemText(i, t.entries[idx].Name, t.secondary(idx))
+			return
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Transform is a built-in transformation of the converted text, enabled by
+// name in the config file. Line transforms are applied to each paragraph
+// outside preformatted blocks, and to footnotes. Text transforms are applied
+// to the text between preformatted blocks and may only remove or merge blank
+// lines, so that the positions of links and anchors can follow.
+type Transform struct {
+	Description string
+	Line        func(string) string
+	Text        func(string) string
+}
+
+// Transforms lists the built-in transforms by name.
+var Transforms = map[string]Transform{
+	"smartquotes": {
+		Description: "turn straight quotes into curly ones",
+		Line:        smartQuotes,
+	},
+	"dashes": {
+		Description: "turn -- and --- into en and em dashes",
+		Line:        dashesReplacer.Replace,
+	},
+	"ellipsis": {
+		Description: "turn ... into an ellipsis",
+		Line:        ellipsisReplacer.Replace,
+	},
+	"collapse-spaces": {
+		Description: "collapse runs of spaces inside paragraphs",
+		Line:        collapseSpaces,
+	},
+	"trim": {
+		Description: "remove the spaces at the end of lines",
+		Line: func(line string) string {
+			return strings.TrimRightFunc(line, unicode.IsSpace)
+		},
+	},
+	"dedupe-blanklines": {
+		Description: "leave at most one blank line between paragraphs",
+		Text:        dedupeBlankLines,
+	},
+	"typography": {
+		Description: "smartquotes, dashes, ellipsis and dedupe-blanklines together",
+		Line: func(line string) string {
+			return smartQuotes(ellipsisReplacer.Replace(dashesReplacer.Replace(line)))
+		},
+		Text: dedupeBlankLines,
+	},
+}
+
+// The replacers of the dashes and ellipsis transforms, which typography
+// applies too.
+var (
+	dashesReplacer   = strings.NewReplacer("---", "—", "--", "–")
+	ellipsisReplacer = strings.NewReplacer("...", "…")
+)
+
+// textTransforms holds the names of the transforms applied to the converted
+// text, in order, set from the config file.
+var textTransforms []string
+
+// TextTransforms returns the configured transforms that exist, warning about
+// the unknown ones.
+// Typography adds the typography transform before the others.
+func (cfg Config) TextTransforms() ([]string, []string) {
+	var names, warnings []string
+	if cfg.Typography {
+		names = append(names, "typography")
+	}
+	for _, name := range cfg.Transforms {
+		if name == "typography" && cfg.Typography {
+			continue
+		}
+		if _, ok := Transforms[name]; !ok {
+			warnings = append(warnings, fmt.Sprintf("unknown transform %q", name))
+			continue
+		}
+		names = append(names, name)
+	}
+
+	return names, warnings
+}
+
+// applyTransforms applies the transforms to the content, in order.
+func applyTransforms(content Content, names []string) Content {
+	for _, name := range names {
+		t := Transforms[name]
+		if t.Line != nil {
+			content = transformLines(content, t.Line)
+		}
+		if t.Text != nil {
+			content = transformText(content, t.Text)
+		}
+	}
+
+	return content
+}
+
+func transformLines(content Content, fn func(string) string) Content {
+	code := map[int]bool{}
+	for _, line := range content.Preformatted {
+		code[line] = true
+	}
+
+	lines := strings.Split(content.Text, "\n")
+	for i, line := range lines {
+		if !code[i] {
+			lines[i] = fn(line)
+		}
+	}
+	content.Text = strings.Join(lines, "\n")
+
+	footnotes := make([]Footnote, len(content.Footnotes))
+	for i, note := range content.Footnotes {
+		footnotes[i] = Footnote{ID: note.ID, Text: fn(note.Text)}
+	}
+	content.Footnotes = footnotes
+
+	return content
+}
+
+// transformText applies fn to each part of the text between preformatted
+// blocks, moving the lines links, anchors and preformatted blocks are on to
+// the lines they became.
+func transformText(content Content, fn func(string) string) Content {
+	code := map[int]bool{}
+	for _, line := range content.Preformatted {
+		code[line] = true
+	}
+
+	before := strings.Split(content.Text, "\n")
+	moved := make([]int, len(before))
+	var out, part []string
+	from := 0
+	flush := func() {
+		if len(part) == 0 {
+			return
+		}
+		after := strings.Split(fn(strings.Join(part, "\n")), "\n")
+		for i, line := range movedLines(part, after) {
+			moved[from+i] = len(out) + line
+		}
+		out = append(out, after...)
+		part = nil
+	}
+	for i, line := range before {
+		if code[i] {
+			flush()
+			moved[i] = len(out)
+			out = append(out, line)
+			continue
+		}
+		if len(part) == 0 {
+			from = i
+		}
+		part = append(part, line)
+	}
+	flush()
+	content.Text = strings.Join(out, "\n")
+
+	move := func(line int) int {
+		if line < 0 || line >= len(moved) {
+			return line
+		}
+		return moved[line]
+	}
+
+	links := make([]Link, len(content.Links))
+	for i, link := range content.Links {
+		link.Line = move(link.Line)
+		links[i] = link
+	}
+	content.Links = links
+	anchors := make(map[string]int, len(content.Anchors))
+	for id, line := range content.Anchors {
+		anchors[id] = move(line)
+	}
+	content.Anchors = anchors
+	var preformatted []int
+	for _, line := range content.Preformatted {
+		if line := move(line); len(preformatted) == 0 || preformatted[len(preformatted)-1] != line {
+			preformatted = append(preformatted, line)
+		}
+	}
+	content.Preformatted = preformatted
+
+	return content
+}
+
+// movedLines returns the line of after each line of before became, the
+// non-blank lines being kept in order and the blank ones moving to the next
+// non-blank line.
+func movedLines(before, after []string) []int {
+	var kept []int
+	for i, line := range after {
+		if strings.TrimSpace(line) != "" {
+			kept = append(kept, i)
+		}
+	}
+
+	moved := make([]int, len(before))
+	n := 0
+	for i := len(before) - 1; i >= 0; i-- {
+		if strings.TrimSpace(before[i]) != "" {
+			n++
+		}
+		moved[i] = len(after) - 1
+		if k := len(kept) - n; n > 0 && k >= 0 {
+			moved[i] = kept[k]
+		}
+	}
+
+	return moved
+}
+
+var blankLines = regexp.MustCompile(`\n([ \t]*\n){2,}`)
+
+func dedupeBlankLines(text string) string {
+	return blankLines.ReplaceAllString(text, "\n\n")
+}
+
+var spaces = regexp.MustCompile(`(\S) {2,}`)
+
+// collapseSpaces collapses the runs of spaces after the start of the line,
+// leaving indentation alone.
+func collapseSpaces(line string) string {
+	return spaces.ReplaceAllString(line, "$1 ")
+}
+
+// smartQuotes replaces straight quotes with curly ones, opening after a
+// space or an opening bracket, closing otherwise.
+func smartQuotes(line string) string {
+	if !strings.ContainsAny(line, `"'`) {
+		return line
+	}
+
+	var out strings.Builder
+	previous := ' '
+	for _, r := range line {
+		opening := unicode.IsSpace(previous) || strings.ContainsRune("([{—–", previous) || previous == '“' && r == '\''
+		switch {
+		case r == '"' && opening:
+			out.WriteRune('“')
+		case r == '"':
+			out.WriteRune('”')
+		case r == '\'' && opening:
+			out.WriteRune('‘')
+		case r == '\'':
+			out.WriteRune('’')
+		default:
+			out.WriteRune(r)
+		}
+		if !isMarkup(r) {
+			previous = r
+		}
+	}
+
+	return out.String()
+}
+
+// transformsKey identifies the transforms the text was converted with, so
+// that cached conversions are discarded when they change.
+func transformsKey(names []string) string {
+	return strings.Join(names, ",")
+}
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestTypographyDashes(t *testing.T) {
+	typography, dashes := Transforms["typography"].Line, Transforms["dashes"].Line
+	for _, line := range []string{"pages 10--12", "wait---what", "a -- b --- c"} {
+		if actual, expected := typography(line), dashes(line); actual != expected {
+			t.Errorf("typography(%q) = %q, expected %q like dashes", line, actual, expected)
+		}
+	}
+	if actual := typography(`"Well..." -- she said`); actual != "“Well…” – she said" {
+		t.Errorf("typography = %q", actual)
+	}
+}
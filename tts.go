@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// abbreviations are the words of each language, lowercased and without their
+// final period, that don't end a sentence when followed by one. The English
+// ones are used for the other languages.
+var abbreviations = map[string]map[string]bool{
+	"en": {
+		"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "st": true,
+		"jr": true, "sr": true, "mt": true, "vs": true, "etc": true, "e.g": true,
+		"i.e": true, "cf": true, "no": true, "vol": true, "ch": true, "fig": true,
+		"p": true, "pp": true, "ed": true, "approx": true,
+	},
+	"fr": {
+		"m": true, "mme": true, "mlle": true, "mm": true, "dr": true, "pr": true,
+		"st": true, "ste": true, "etc": true, "cf": true, "p": true, "vol": true,
+		"ch": true, "fig": true, "env": true, "av": true, "apr": true, "j.-c": true,
+	},
+	"de": {
+		"z.b": true, "d.h": true, "u.a": true, "usw": true, "bzw": true, "vgl": true,
+		"ca": true, "dr": true, "prof": true, "hr": true, "fr": true, "nr": true,
+		"s": true, "bd": true, "st": true, "evtl": true, "ggf": true,
+	},
+	"es": {
+		"sr": true, "sra": true, "srta": true, "dr": true, "dra": true, "d": true,
+		"dña": true, "ud": true, "uds": true, "etc": true, "p": true, "pág": true,
+		"vol": true, "cap": true, "fig": true, "núm": true,
+	},
+}
+
+// languageAbbreviations returns the abbreviations of the language tag.
+func languageAbbreviations(language string) map[string]bool {
+	if a, ok := abbreviations[baseLanguage(language)]; ok {
+		return a
+	}
+
+	return abbreviations[DefaultLanguage]
+}
+
+// referenceMarker matches the markers of links and footnote references, which
+// aren't meant to be read aloud.
+var referenceMarker = regexp.MustCompile(`\[\d+\]`)
+
+// exportSpeech writes the text of the book to w for text-to-speech tools: one
+// sentence per line, paragraphs separated by blank lines, and each chapter
+// starting with its title. Only the chapter selected by chapter is written
+// when it isn't empty.
+func exportSpeech(w io.Writer, fname string, chapter string) error {
+	ebook, err := openBook(fname)
+	if err != nil {
+		return err
+	}
+	defer ebook.Close()
+
+	toc, err := ebook.TOC()
+	if err != nil {
+		return fmt.Errorf("%s: reading table of contents: %s", fname, err)
+	}
+	language, _ := bookLanguage(ebook, toc)
+	selected, err := findChapter(toc, chapter)
+	if err != nil {
+		return fmt.Errorf("%s: %s", fname, err)
+	}
+
+	for i, entry := range toc {
+		if selected != -1 && i != selected {
+			continue
+		}
+
+		text, err := ebook.ReadChapter(entry.URL)
+		if err != nil {
+			return fmt.Errorf("%s: reading chapter %q: %s", fname, entry.Name, err)
+		}
+
+		if i > 0 && selected == -1 {
+			fmt.Fprint(w, "\n")
+		}
+		fmt.Fprintf(w, "%s\n\n", entry.Name)
+		for _, paragraph := range speechParagraphs(text) {
+			_, err = fmt.Fprintf(w, "%s\n\n", strings.Join(splitSentences(paragraph, language), "\n"))
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return ebook.SaveCache()
+}
+
+// speechParagraphs returns the paragraphs of a chapter's text, without
+// reference markers, heading prefixes or scene breaks.
+func speechParagraphs(text string) []string {
+	var paragraphs []string
+	for _, line := range strings.Split(text, "\n") {
+		line = referenceMarker.ReplaceAllString(line, "")
+		line = strings.TrimLeft(line, "#")
+		line = strings.Join(strings.Fields(line), " ")
+		if line == "" || line == sceneBreak {
+			continue
+		}
+		paragraphs = append(paragraphs, line)
+	}
+
+	return paragraphs
+}
+
+// splitSentences splits a paragraph after each word ending with a period, a
+// question or an exclamation mark, possibly followed by closing quotes or
+// brackets. Periods ending abbreviations of the language and initials don't
+// end sentences.
+func splitSentences(paragraph, language string) []string {
+	abbreviations := languageAbbreviations(language)
+	var sentences []string
+	var sentence []string
+	for _, word := range strings.Fields(paragraph) {
+		sentence = append(sentence, word)
+		if endsSentence(word, abbreviations) {
+			sentences = append(sentences, strings.Join(sentence, " "))
+			sentence = nil
+		}
+	}
+	if len(sentence) > 0 {
+		sentences = append(sentences, strings.Join(sentence, " "))
+	}
+
+	return sentences
+}
+
+func endsSentence(word string, abbreviations map[string]bool) bool {
+	word = strings.TrimRight(word, `"')]»”’」』`)
+	if word == "" {
+		return false
+	}
+	switch r, _ := utf8.DecodeLastRuneInString(word); r {
+	case '!', '?', '؟', '。', '！', '？':
+		return true
+	case '.':
+	default:
+		return false
+	}
+
+	stem := strings.TrimLeft(strings.TrimSuffix(word, "."), `"'([«“‘`)
+	if abbreviations[strings.ToLower(stem)] {
+		return false
+	}
+	if r, size := utf8.DecodeRuneInString(stem); size == len(stem) && unicode.IsUpper(r) {
+		// an initial, as in "J. R. R. Tolkien"
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"time"
+)
+
+// DefaultWordsPerPage is the number of words in a page, for page estimates,
+// unless configured otherwise.
+const DefaultWordsPerPage = 300
+
+// WordCounts holds the number of words in each chapter of a book, along with
+// the size and modification time of the file they were counted in, so that
+// they are counted again when the book changes.
+type WordCounts struct {
+	Size     int64
+	ModTime  time.Time
+	Chapters []int
+}
+
+// countBookWords counts the words of each chapter of the book.
+func countBookWords(fname string, r Reader, toc []TOCEntry) (WordCounts, error) {
+	var counts WordCounts
+
+	info, err := os.Stat(fname)
+	if err != nil {
+		return counts, err
+	}
+	counts.Size, counts.ModTime = info.Size(), info.ModTime()
+
+	for _, entry := range toc {
+		text, err := r.ReadChapter(entry.URL)
+		if err != nil {
+			return counts, err
+		}
+		counts.Chapters = append(counts.Chapters, countWords(text))
+	}
+
+	return counts, nil
+}
+
+// Valid reports whether the counts are those of the book at fname, with the
+// given number of chapters.
+func (w *WordCounts) Valid(fname string, chapters int) bool {
+	if w == nil || len(w.Chapters) != chapters {
+		return false
+	}
+	info, err := os.Stat(fname)
+	if err != nil {
+		return false
+	}
+
+	return info.Size() == w.Size && info.ModTime().Equal(w.ModTime)
+}
+
+func (w WordCounts) Total() int {
+	total := 0
+	for _, n := range w.Chapters {
+		total += n
+	}
+
+	return total
+}
+
+// pageCount returns the number of pages the words would fill, rounded up.
+func pageCount(words, wordsPerPage int) int {
+	if wordsPerPage <= 0 {
+		wordsPerPage = DefaultWordsPerPage
+	}
+
+	return (words + wordsPerPage - 1) / wordsPerPage
+}
+
+// BookWordCounts returns the word counts of the book, counting them the
+// first time unless they were saved in the state.
+func (b *Book) BookWordCounts() (WordCounts, error) {
+	if b.WordCounts.Valid(b.fname, len(b.TOC.entries)) {
+		return *b.WordCounts, nil
+	}
+
+	counts, err := countBookWords(b.fname, b.ebook, b.TOC.entries)
+	if err != nil {
+		return counts, err
+	}
+	b.WordCounts = &counts
+
+	return counts, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"strings"
+)
+
+// Wraps reports whether the lines of the chapter idx are wrapped: as set with
+// ToggleWrap, else unless most of its text is preformatted, like code
+// listings whose indentation wrapping would break.
+func (b Book) Wraps(idx int) bool {
+	switch b.Wrap {
+	case "on":
+		return true
+	case "off":
+		return false
+	}
+
+	c := b.Chapters[idx]
+	prose, code := 0, 0
+	for i, line := range strings.Split(c.text, "\n") {
+		switch {
+		case strings.TrimSpace(line) == "":
+		case c.code[i]:
+			code++
+		default:
+			prose++
+		}
+	}
+
+	return code <= prose
+}
+
+// applyWrap sets the wrapping of the chapter idx, wrapped chapters not being
+// scrolled horizontally.
+func (b *Book) applyWrap(idx int) {
+	c := b.Chapters[idx]
+	wrap := b.Wraps(idx)
+	c.t.SetWrap(wrap)
+	c.right.SetWrap(wrap)
+	c.wraps = wrap
+	if wrap {
+		c.SetColumn(0)
+	}
+}
+
+// HorizontalStep is the number of columns scrolled by ScrollRight and
+// ScrollLeft.
+const HorizontalStep = 8
+
+// ScrollRight scrolls the current chapter to the right, if it isn't wrapped.
+func (b *Book) ScrollRight() {
+	b.scrollHorizontally(HorizontalStep)
+}
+
+// ScrollLeft scrolls the current chapter to the left, if it isn't wrapped.
+func (b *Book) ScrollLeft() {
+	b.scrollHorizontally(-HorizontalStep)
+}
+
+func (b *Book) scrollHorizontally(n int) {
+	if b.Current == b.TOC.Index() {
+		return
+	}
+	c := b.Chapters[b.Current]
+	if !c.loaded {
+		return
+	}
+	if b.Wraps(b.Current) {
+		b.Flash("lines are wrapped, turn wrapping off to scroll horizontally")
+		return
+	}
+
+	c.SetColumn(c.column + n)
+}
+
+// SetColumn scrolls the chapter horizontally to col, without going past the
+// end of the longest line.
+func (c *Chapter) SetColumn(col int) {
+	if last := c.maxColumn(); col > last {
+		col = last
+	}
+	if col < 0 {
+		col = 0
+	}
+
+	c.column = col
+	if c.loaded {
+		c.t.ScrollTo(c.GetOffset(), col)
+	}
+}
+
+// maxColumn returns the largest horizontal scroll offset leaving the end of
+// the longest line visible.
+func (c Chapter) maxColumn() int {
+	if !c.loaded {
+		return 0
+	}
+	_, _, width, _ := c.t.GetInnerRect()
+
+	longest := 0
+	for _, line := range strings.Split(c.t.GetText(true), "\n") {
+		if w := textWidth(line); w > longest {
+			longest = w
+		}
+	}
+	if longest < width {
+		return 0
+	}
+
+	return longest - width
+}
+
+// ToggleWrap switches line wrapping for the whole book, overriding the
+// default of each chapter.
+func (b *Book) ToggleWrap() {
+	idx := b.Current
+	if idx == b.TOC.Index() {
+		idx = b.menuContext
+	}
+
+	wrap := true
+	if idx >= 0 && idx < len(b.Chapters) && b.Chapters[idx].loaded {
+		wrap = b.Wraps(idx)
+	}
+	if wrap {
+		b.Wrap = "off"
+		b.Flash("line wrapping off")
+	} else {
+		b.Wrap = "on"
+		b.Flash("line wrapping on")
+	}
+
+	for i, c := range b.Chapters {
+		if c.loaded {
+			b.applyWrap(i)
+		}
+	}
+}
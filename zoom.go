@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+)
+
+// The zoom levels. Zooming in narrows the text and adds to the margins, for a
+// more focused page, zooming out widens the text and removes margins. At
+// level 0 the text is DefaultZoomWidth wide, with the configured margin.
+const (
+	MinZoom          = -4
+	MaxZoom          = 6
+	DefaultZoomWidth = 80
+	// zoomStep is the number of columns the text narrows by with each
+	// level.
+	zoomStep = 8
+	// minZoomLines is the number of lines of text the margins always leave.
+	minZoomLines = 10
+)
+
+// zoomWidth returns the width of the text at the zoom level.
+func zoomWidth(zoom int) int {
+	return DefaultZoomWidth - zoom*zoomStep
+}
+
+// margin returns the number of blank lines above and below the text: the
+// configured margin, plus one per level zoomed in, minus one per level
+// zoomed out, leaving at least minZoomLines lines of text once the height of
+// the terminal is known.
+func (b Book) margin() int {
+	margin := b.Margin + b.Zoom
+	if _, _, _, height := b.base.GetRect(); height > 0 && height-2*margin < minZoomLines {
+		margin = (height - minZoomLines) / 2
+	}
+	if margin < 0 {
+		margin = 0
+	}
+
+	return margin
+}
+
+// SetZoom sets the zoom level, clamped between MinZoom and MaxZoom, and
+// between the levels at which the text fits in the terminal once its width
+// is known.
+func (b *Book) SetZoom(zoom int) {
+	if zoom < MinZoom {
+		zoom = MinZoom
+	}
+	if zoom > MaxZoom {
+		zoom = MaxZoom
+	}
+	if _, _, available, _ := b.base.GetRect(); available >= MinWidth {
+		for zoom < MaxZoom && zoomWidth(zoom) > available {
+			zoom++
+		}
+	}
+	if zoom == b.Zoom && zoomWidth(zoom) == b.Width {
+		b.Flash(fmt.Sprintf("zoom: %d", zoom))
+		return
+	}
+
+	b.Zoom = zoom
+	b.SetWidth(zoomWidth(zoom))
+	b.layoutChapters()
+	b.Flash(fmt.Sprintf("zoom: %d", zoom))
+}